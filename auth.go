@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/go-ini/ini"
+)
+
+const headerKeyPrefix = "header."
+
+// secret is a credential given either inline, through an environment
+// variable or as the output of a shell command.
+type secret struct {
+	Value   string
+	Env     string
+	Command string
+}
+
+func (s secret) isSet() bool {
+	return s.Value != "" || s.Env != "" || s.Command != ""
+}
+
+func (s secret) resolve() (string, error) {
+	switch {
+	case s.Value != "":
+		return s.Value, nil
+	case s.Env != "":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+		return value, nil
+	case s.Command != "":
+		entry, _ := commandSecrets.LoadOrStore(s.Command, &commandSecret{})
+		cached := entry.(*commandSecret)
+		cached.once.Do(func() {
+			cached.value, cached.err = runSecretCommand(s.Command)
+		})
+		return cached.value, cached.err
+	}
+	return "", nil
+}
+
+// commandSecrets caches the output of secret commands by command, so that
+// a command prompting for a passphrase runs at most once per run however
+// many requests need its secret.
+var commandSecrets sync.Map
+
+type commandSecret struct {
+	once  sync.Once
+	value string
+	err   error
+}
+
+func runSecretCommand(command string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("run %q: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// AuthOptions holds the credentials sent with requests for a single feed.
+type AuthOptions struct {
+	Username string
+	Password secret
+	Token    secret
+	Cookie   secret
+	Headers  map[string]string
+}
+
+func loadSecret(section *ini.Section, name string) (secret, error) {
+	s := secret{
+		Value:   section.Key(name).String(),
+		Env:     strings.TrimSpace(section.Key(name + "_env").String()),
+		Command: strings.TrimSpace(section.Key(name + "_command").String()),
+	}
+
+	set := 0
+	for _, part := range []string{s.Value, s.Env, s.Command} {
+		if part != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return s, fmt.Errorf("only one of %s, %s_env and %s_command may be set", name, name, name)
+	}
+	return s, nil
+}
+
+func loadAuthOptions(section *ini.Section) (AuthOptions, error) {
+	var auth AuthOptions
+	var err error
+
+	auth.Username = strings.TrimSpace(section.Key("username").String())
+	if auth.Password, err = loadSecret(section, "password"); err != nil {
+		return auth, err
+	}
+	if auth.Password.isSet() && auth.Username == "" {
+		return auth, fmt.Errorf("password given without username")
+	}
+	if auth.Token, err = loadSecret(section, "token"); err != nil {
+		return auth, err
+	}
+	if auth.Username != "" && auth.Token.isSet() {
+		return auth, fmt.Errorf("only one of username and token may be set")
+	}
+	if auth.Cookie, err = loadSecret(section, "cookie"); err != nil {
+		return auth, err
+	}
+
+	for _, key := range section.Keys() {
+		if !strings.HasPrefix(key.Name(), headerKeyPrefix) {
+			continue
+		}
+		name := strings.TrimSpace(strings.TrimPrefix(key.Name(), headerKeyPrefix))
+		if name == "" {
+			return auth, fmt.Errorf("header key %q has no header name", key.Name())
+		}
+		if auth.Headers == nil {
+			auth.Headers = map[string]string{}
+		}
+		auth.Headers[name] = key.String()
+	}
+
+	return auth, nil
+}
+
+// customHeadersKey is the request context key holding the names of the
+// custom headers set on a request, which checkRedirect drops when a redirect
+// leaves the feed's host.
+type customHeadersKey struct{}
+
+// apply adds the configured credentials and headers to req, resolving any
+// secrets held in the environment or behind a command.
+func (a AuthOptions) apply(req *http.Request) error {
+	if len(a.Headers) > 0 {
+		names := make([]string, 0, len(a.Headers))
+		for name, value := range a.Headers {
+			req.Header.Set(name, value)
+			names = append(names, name)
+		}
+		*req = *req.WithContext(context.WithValue(req.Context(), customHeadersKey{}, names))
+	}
+
+	if a.Username != "" {
+		password, err := a.Password.resolve()
+		if err != nil {
+			return fmt.Errorf("resolve password: %w", err)
+		}
+		req.SetBasicAuth(a.Username, password)
+	}
+
+	if a.Token.isSet() {
+		token, err := a.Token.resolve()
+		if err != nil {
+			return fmt.Errorf("resolve token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if a.Cookie.isSet() {
+		cookie, err := a.Cookie.resolve()
+		if err != nil {
+			return fmt.Errorf("resolve cookie: %w", err)
+		}
+		if existing := req.Header.Get("Cookie"); existing != "" {
+			cookie = existing + "; " + cookie
+		}
+		req.Header.Set("Cookie", cookie)
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-ini/ini"
+)
+
+func loadTestSection(t *testing.T, content string) *ini.Section {
+	t.Helper()
+	cfg, err := loadINI([]byte("[feed \"test\"]\n" + content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Section(feedSectionName("test"))
+}
+
+func TestAuthOptionsBasicAuthFromEnv(t *testing.T) {
+	t.Setenv("RSSNIX_TEST_PASSWORD", "s3cret")
+
+	auth, err := loadAuthOptions(loadTestSection(t, "username = alice\npassword_env = RSSNIX_TEST_PASSWORD\nheader.X-Api-Version = 2\ncookie = session=abc\n"))
+	if err != nil {
+		t.Fatalf("loadAuthOptions returned error: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/feed", nil)
+	if err := auth.apply(req); err != nil {
+		t.Fatalf("apply returned error: %v", err)
+	}
+
+	user, pass, ok := req.BasicAuth()
+	if !ok || user != "alice" || pass != "s3cret" {
+		t.Fatalf("expected basic auth alice:s3cret, got %q:%q (%v)", user, pass, ok)
+	}
+	if got := req.Header.Get("X-Api-Version"); got != "2" {
+		t.Fatalf("expected custom header, got %q", got)
+	}
+	if got := req.Header.Get("Cookie"); got != "session=abc" {
+		t.Fatalf("expected cookie header, got %q", got)
+	}
+}
+
+func TestAuthOptionsBearerTokenFromCommand(t *testing.T) {
+	auth, err := loadAuthOptions(loadTestSection(t, "token_command = echo abc123\n"))
+	if err != nil {
+		t.Fatalf("loadAuthOptions returned error: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/feed", nil)
+	if err := auth.apply(req); err != nil {
+		t.Fatalf("apply returned error: %v", err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer abc123" {
+		t.Fatalf("expected bearer token from command, got %q", got)
+	}
+}
+
+func TestAuthOptionsResolvesCommandOnce(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "runs")
+	auth, err := loadAuthOptions(loadTestSection(t, "token_command = echo run >> "+counter+" && echo once\n"))
+	if err != nil {
+		t.Fatalf("loadAuthOptions returned error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/feed", nil)
+		if err := auth.apply(req); err != nil {
+			t.Fatalf("apply returned error: %v", err)
+		}
+		if got := req.Header.Get("Authorization"); got != "Bearer once" {
+			t.Fatalf("expected bearer token from command, got %q", got)
+		}
+	}
+
+	runs, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 1 {
+		t.Fatalf("expected the command to run once, ran %d times", n)
+	}
+}
+
+func TestAuthOptionsHeadersDroppedOnCrossHostRedirect(t *testing.T) {
+	var foreignHeader string
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		foreignHeader = r.Header.Get("X-Api-Key")
+	}))
+	t.Cleanup(foreign.Close)
+
+	var sameHostHeader string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			http.Redirect(w, r, "/moved", http.StatusFound)
+		case "/moved":
+			sameHostHeader = r.Header.Get("X-Api-Key")
+			// The same server under another host name.
+			http.Redirect(w, r, strings.Replace(foreign.URL, "127.0.0.1", "localhost", 1)+"/feed", http.StatusFound)
+		}
+	}))
+	t.Cleanup(origin.Close)
+
+	auth, err := loadAuthOptions(loadTestSection(t, "header.X-Api-Key = abc\n"))
+	if err != nil {
+		t.Fatalf("loadAuthOptions returned error: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, origin.URL+"/feed", nil)
+	if err := auth.apply(req); err != nil {
+		t.Fatalf("apply returned error: %v", err)
+	}
+	client, err := httpClientFor(HTTPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if sameHostHeader != "abc" {
+		t.Fatalf("expected header to be kept on a same-host redirect, got %q", sameHostHeader)
+	}
+	if foreignHeader != "" {
+		t.Fatalf("expected header to be dropped on a cross-host redirect, got %q", foreignHeader)
+	}
+}
+
+func TestAuthOptionsValidation(t *testing.T) {
+	invalid := []string{
+		"password = secret\n",
+		"username = alice\npassword = a\npassword_env = B\n",
+		"username = alice\ntoken = abc\n",
+	}
+	for _, content := range invalid {
+		if _, err := loadAuthOptions(loadTestSection(t, content)); err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+
+	auth, err := loadAuthOptions(loadTestSection(t, "token_env = RSSNIX_TEST_UNSET_TOKEN\n"))
+	if err != nil {
+		t.Fatalf("loadAuthOptions returned error: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/feed", nil)
+	if err := auth.apply(req); err == nil {
+		t.Fatalf("expected unset environment variable to be reported")
+	}
+}
+
+func TestLoadConfigKeepsSemicolonsAndHashesInCredentials(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	content := "[feed \"Private\"]\n" +
+		"; a comment\n" +
+		"url = https://example.com/feed\n" +
+		"username = alice\n" +
+		"password = p#ss\n" +
+		"cookie = session=abc; theme=dark\n" +
+		"header.Accept = text/html;q=0.9\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		t.Helper()
+		if err := LoadConfig(); err != nil {
+			t.Fatalf("LoadConfig returned error: %v", err)
+		}
+		feed, ok := Config.FeedByName("Private")
+		if !ok {
+			t.Fatal("expected feed to be loaded")
+		}
+		if feed.Auth.Password.Value != "p#ss" || feed.Auth.Cookie.Value != "session=abc; theme=dark" ||
+			feed.Auth.Headers["Accept"] != "text/html;q=0.9" {
+			t.Fatalf("expected values to be kept whole, got %+v", feed.Auth)
+		}
+	}
+	check()
+
+	// Values must survive the config being rewritten as well.
+	if err := addFeed("Other", "https://example.com/other", ""); err != nil {
+		t.Fatalf("addFeed returned error: %v", err)
+	}
+	check()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Verdicts of a feed check.
+const (
+	checkOK    = "ok"
+	checkStale = "stale"
+	checkDead  = "dead"
+)
+
+// feedCheck is the result of fetching and parsing a configured feed.
+type feedCheck struct {
+	Name              string     `json:"name"`
+	URL               string     `json:"url"`
+	Verdict           string     `json:"verdict"`
+	Status            int        `json:"status,omitempty"`
+	RedirectedTo      string     `json:"redirected_to,omitempty"`
+	PermanentRedirect bool       `json:"permanent_redirect,omitempty"`
+	Items             int        `json:"items"`
+	Newest            *time.Time `json:"newest,omitempty"`
+	Error             string     `json:"error,omitempty"`
+}
+
+// note describes the error or redirect of a check in a few words.
+func (c feedCheck) note() string {
+	switch {
+	case c.Error != "":
+		return c.Error
+	case c.PermanentRedirect:
+		return "moved permanently to " + c.RedirectedTo
+	case c.RedirectedTo != "":
+		return "redirected to " + c.RedirectedTo
+	case c.Verdict == checkStale && c.Items == 0:
+		return "no items"
+	}
+	return "-"
+}
+
+// checkFeed fetches and parses a feed without storing anything. Feeds that
+// cannot be fetched or parsed are dead; feeds without items, or whose newest
+// item is older than staleAfter, are stale.
+func checkFeed(feed Feed, staleAfter time.Duration) feedCheck {
+	check := feedCheck{Name: feed.Name, URL: feed.URL, Verdict: checkDead}
+
+	client, err := httpClientFor(feed.HTTP)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	req, err := newFeedRequest(feed)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+
+	// Redirects are followed as usual, but recorded on the way.
+	recording := *client
+	recording.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := checkRedirect(req, via); err != nil {
+			return err
+		}
+		permanent := req.Response != nil &&
+			(req.Response.StatusCode == http.StatusMovedPermanently || req.Response.StatusCode == http.StatusPermanentRedirect)
+		// A chain is only permanent if every hop is.
+		check.PermanentRedirect = permanent && (len(via) == 1 || check.PermanentRedirect)
+		check.RedirectedTo = req.URL.String()
+		return nil
+	}
+
+	resp, err := doWithRetry(&recording, req, feed.HTTP)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	defer resp.Body.Close()
+
+	check.Status = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		check.Error = "HTTP " + resp.Status
+		return check
+	}
+
+	parsed, err := parseFeedResponse(feed, resp)
+	if err != nil {
+		check.Error = "parse: " + err.Error()
+		return check
+	}
+
+	check.Items = len(parsed.Items)
+	for _, item := range parsed.Items {
+		if date := itemDate(item); date != nil && (check.Newest == nil || date.After(*check.Newest)) {
+			check.Newest = date
+		}
+	}
+
+	check.Verdict = checkOK
+	if check.Items == 0 || check.Newest != nil && staleAfter > 0 && time.Since(*check.Newest) > staleAfter {
+		check.Verdict = checkStale
+	}
+	return check
+}
+
+// checkFeeds checks the named feeds concurrently, within the same limits as
+// an update.
+func checkFeeds(names []string, staleAfter time.Duration) []feedCheck {
+	checks := make([]feedCheck, len(names))
+
+	limit := Config.MaxConcurrency
+	if limit < 1 {
+		limit = defaultMaxConcurrency
+	}
+	sem := make(chan struct{}, limit)
+	hosts := newHostLimiter(Config.PerHostConcurrency, Config.PerHostDelay, nil)
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		i, name := i, name
+		feed, ok := Config.FeedByName(name)
+		if !ok {
+			checks[i] = feedCheck{Name: name, Verdict: checkDead, Error: "feed not found"}
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := hosts.acquire(feedHost(feed.URL))
+			defer release()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			checks[i] = checkFeed(feed, staleAfter)
+		}()
+	}
+
+	wg.Wait()
+	return checks
+}
+
+func writeFeedChecksJSON(w io.Writer, checks []feedCheck) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(checks)
+}
+
+func writeFeedChecksTable(w io.Writer, checks []feedCheck) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERDICT\tHTTP\tITEMS\tNEWEST\tNOTE")
+	for _, check := range checks {
+		status := "-"
+		if check.Status != 0 {
+			status = strconv.Itoa(check.Status)
+		}
+		newest := "-"
+		if check.Newest != nil {
+			newest = check.Newest.Local().Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n",
+			check.Name, check.Verdict, status, check.Items, newest, truncateString(check.note(), 80))
+	}
+	return tw.Flush()
+}
+
+// checkExitError returns an error carrying a non-zero exit code when any of
+// the checked feeds is dead or stale.
+func checkExitError(checks []feedCheck) error {
+	dead, stale := 0, 0
+	for _, check := range checks {
+		switch check.Verdict {
+		case checkDead:
+			dead++
+		case checkStale:
+			stale++
+		}
+	}
+	switch {
+	case dead == 0 && stale == 0:
+		return nil
+	case dead == len(checks):
+		return cli.Exit(fmt.Sprintf("all %d feeds are dead", dead), exitTotalFailure)
+	default:
+		return cli.Exit(fmt.Sprintf("%d dead and %d stale of %d feeds", dead, stale, len(checks)), exitPartialFailure)
+	}
+}
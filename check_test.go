@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestCheckFeeds(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(configEnvVar, "")
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	recent := time.Now().Add(-24 * time.Hour).UTC().Format(time.RFC1123Z)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fresh":
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Fresh</title>` +
+				`<item><title>New</title><pubDate>` + recent + `</pubDate></item>` +
+				`<item><title>Old</title><pubDate>Mon, 02 Jan 2006 12:00:00 GMT</pubDate></item>` +
+				`</channel></rss>`))
+		case "/stale":
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Stale</title>` +
+				`<item><title>Old</title><pubDate>Mon, 02 Jan 2006 12:00:00 GMT</pubDate></item>` +
+				`</channel></rss>`))
+		case "/empty":
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Empty</title></channel></rss>`))
+		case "/moved":
+			http.Redirect(w, r, "/fresh", http.StatusMovedPermanently)
+		case "/temporary":
+			http.Redirect(w, r, "/moved", http.StatusFound)
+		case "/page":
+			_, _ = w.Write([]byte(`<html><body>Not a feed</body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	for _, name := range []string{"fresh", "stale", "empty", "moved", "temporary", "page", "gone"} {
+		Config.Feeds = append(Config.Feeds, Feed{Name: name, URL: server.URL + "/" + name, FeedOptions: Config.Defaults})
+	}
+
+	checks := checkFeeds([]string{"fresh", "stale", "empty", "moved", "temporary", "page", "gone", "unknown"}, 30*24*time.Hour)
+	byName := map[string]feedCheck{}
+	for _, check := range checks {
+		byName[check.Name] = check
+	}
+
+	fresh := byName["fresh"]
+	if fresh.Verdict != checkOK || fresh.Status != http.StatusOK || fresh.Items != 2 || fresh.Newest == nil || fresh.RedirectedTo != "" {
+		t.Errorf("unexpected check of fresh feed: %+v", fresh)
+	}
+	if stale := byName["stale"]; stale.Verdict != checkStale || stale.Items != 1 {
+		t.Errorf("expected old feed to be stale, got %+v", stale)
+	}
+	if empty := byName["empty"]; empty.Verdict != checkStale || empty.note() != "no items" {
+		t.Errorf("expected empty feed to be stale, got %+v", empty)
+	}
+	if moved := byName["moved"]; moved.Verdict != checkOK || !moved.PermanentRedirect || moved.RedirectedTo != server.URL+"/fresh" {
+		t.Errorf("expected permanent redirect to be reported, got %+v", moved)
+	}
+	if temporary := byName["temporary"]; temporary.PermanentRedirect || temporary.RedirectedTo != server.URL+"/fresh" {
+		t.Errorf("expected redirect chain with a temporary hop not to be permanent, got %+v", temporary)
+	}
+	if page := byName["page"]; page.Verdict != checkDead || page.Status != http.StatusOK || page.Error == "" {
+		t.Errorf("expected unparseable feed to be dead, got %+v", page)
+	}
+	if gone := byName["gone"]; gone.Verdict != checkDead || gone.Status != http.StatusNotFound {
+		t.Errorf("expected missing feed to be dead, got %+v", gone)
+	}
+	if unknown := byName["unknown"]; unknown.Verdict != checkDead {
+		t.Errorf("expected unknown feed to be dead, got %+v", unknown)
+	}
+
+	var exitErr cli.ExitCoder
+	if err := checkExitError(checks); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitPartialFailure {
+		t.Fatalf("expected partial failure exit code, got %v", err)
+	}
+	if err := checkExitError([]feedCheck{fresh}); err != nil {
+		t.Fatalf("expected no error when all feeds are fine, got %v", err)
+	}
+	if err := checkExitError([]feedCheck{byName["gone"]}); !errors.As(err, &exitErr) || exitErr.ExitCode() != exitTotalFailure {
+		t.Fatalf("expected total failure exit code, got %v", err)
+	}
+}
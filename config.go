@@ -4,8 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-ini/ini"
 	log "github.com/sirupsen/logrus"
@@ -17,12 +21,47 @@ const (
 	configFileName       = "config.ini"
 	defaultViewer        = "vim"
 	defaultFeedDirectory = "~/rssnix"
+
+	defaultMaxConcurrency     = 8
+	defaultPerHostConcurrency = 2
 )
 
 type Configuration struct {
-	FeedDirectory string
-	Viewer        string
-	Feeds         []Feed
+	FeedDirectory      string
+	Viewer             string
+	MaxConcurrency     int
+	PerHostConcurrency int
+	PerHostDelay       time.Duration
+	Defaults           FeedOptions
+	Feeds              []Feed
+}
+
+// FeedOptions are the feed settings that can be given globally in
+// [settings] and overridden for a single feed in its [feed "Name"] section.
+type FeedOptions struct {
+	Format           string
+	HTMLImages       string
+	DatePrefix       bool
+	FilenameTemplate string
+	FullText         bool
+	Enclosures       bool
+	EnclosureTypes   []string
+	EnclosureMaxSize int64
+	KeepEnclosures   int
+	Interval         time.Duration
+	Include          *regexp.Regexp
+	Exclude          *regexp.Regexp
+	MaxArticles      int
+	MaxAge           time.Duration
+	HTTP             HTTPOptions
+}
+
+func defaultFeedOptions() FeedOptions {
+	return FeedOptions{
+		Format:     defaultFormat,
+		HTMLImages: htmlImagesRemote,
+		HTTP:       defaultHTTPOptions(),
+	}
 }
 
 var Config Configuration
@@ -53,7 +92,7 @@ func LoadConfig() error {
 		return fmt.Errorf("stat config file: %w", err)
 	}
 
-	cfg, err := ini.Load(cfgPath)
+	cfg, err := loadINI(cfgPath)
 	if err != nil {
 		return fmt.Errorf("load config: %w", err)
 	}
@@ -76,20 +115,76 @@ func LoadConfig() error {
 	}
 	Config.Viewer = viewer
 
-	feedsSection := cfg.Section("feeds")
-	for _, key := range feedsSection.Keys() {
-		name := strings.TrimSpace(key.Name())
-		if name == "" {
+	if Config.MaxConcurrency, err = intSetting(settings, "max_concurrency", 1, defaultMaxConcurrency); err != nil {
+		return err
+	}
+	if Config.PerHostConcurrency, err = intSetting(settings, "per_host_concurrency", 1, defaultPerHostConcurrency); err != nil {
+		return err
+	}
+	if Config.PerHostDelay, err = durationSetting(settings, "per_host_delay", 0); err != nil {
+		return err
+	}
+	if Config.Defaults, err = loadFeedOptions(settings, defaultFeedOptions()); err != nil {
+		return err
+	}
+
+	for _, section := range cfg.Sections() {
+		category, ok := categoryFromFeedsSection(section.Name())
+		if !ok {
+			continue
+		}
+
+		for _, key := range section.Keys() {
+			name := strings.TrimSpace(key.Name())
+			if name == "" {
+				continue
+			}
+
+			url := strings.TrimSpace(key.String())
+			if url == "" {
+				log.WithField("feed", name).Warn("Feed has empty URL; skipping")
+				continue
+			}
+			if _, exists := Config.FeedByName(name); exists {
+				log.WithField("feed", name).Warn("Feed is listed more than once; skipping")
+				continue
+			}
+
+			feed, err := loadFeed(cfg, name, url, category, homePath)
+			if err != nil {
+				return err
+			}
+			Config.Feeds = append(Config.Feeds, feed)
+		}
+	}
+
+	for _, section := range cfg.Sections() {
+		name, ok := feedNameFromSection(section.Name())
+		if !ok {
+			continue
+		}
+		if _, exists := Config.FeedByName(name); exists {
 			continue
 		}
 
-		url := strings.TrimSpace(key.String())
+		url := strings.TrimSpace(section.Key("url").String())
 		if url == "" {
 			log.WithField("feed", name).Warn("Feed has empty URL; skipping")
 			continue
 		}
 
-		Config.Feeds = append(Config.Feeds, Feed{Name: name, URL: url})
+		feed, err := loadFeed(cfg, name, url, "", homePath)
+		if err != nil {
+			return err
+		}
+		Config.Feeds = append(Config.Feeds, feed)
+	}
+
+	if err := validateFeedLayout(Config.Feeds); err != nil {
+		return err
+	}
+	if err := validateFeedDirectories(Config.Feeds); err != nil {
+		return err
 	}
 
 	if len(Config.Feeds) == 0 {
@@ -99,6 +194,357 @@ func LoadConfig() error {
 	return nil
 }
 
+// loadFeed builds a feed from the global defaults and the settings in its
+// [feed "Name"] section, if it has one.
+func loadFeed(cfg *ini.File, name, url, category, home string) (Feed, error) {
+	feed := Feed{Name: name, URL: url, Category: category, FeedOptions: Config.Defaults}
+
+	section, err := cfg.GetSection(feedSectionName(name))
+	if err != nil {
+		return feed, nil
+	}
+
+	if sectionURL := strings.TrimSpace(section.Key("url").String()); sectionURL != "" && sectionURL != url {
+		return feed, fmt.Errorf("feed %q has different URLs in [feeds] and its own section", name)
+	}
+	if section.HasKey("category") {
+		feed.Category = normaliseCategory(section.Key("category").String())
+	}
+	if directory := strings.TrimSpace(section.Key("directory").String()); directory != "" {
+		directory = expandPath(directory, home)
+		if !filepath.IsAbs(directory) {
+			directory = filepath.Join(Config.FeedDirectory, directory)
+		}
+		feed.Directory = directory
+	}
+	if feed.FeedOptions, err = loadFeedOptions(section, Config.Defaults); err != nil {
+		return feed, fmt.Errorf("feed %q: %w", name, err)
+	}
+	if feed.Auth, err = loadAuthOptions(section); err != nil {
+		return feed, fmt.Errorf("feed %q: %w", name, err)
+	}
+	if feed.Scrape, err = loadScrapeOptions(section); err != nil {
+		return feed, fmt.Errorf("feed %q: %w", name, err)
+	}
+
+	return feed, nil
+}
+
+// validateFeedLayout rejects feeds whose directory below feed_directory
+// would clash with the new article directory or with a category, since feed
+// names and categories share the same directories. The name new is reserved
+// for the new article directory.
+func validateFeedLayout(feeds []Feed) error {
+	for _, feed := range feeds {
+		if feed.Name == newArticleDirectory {
+			return fmt.Errorf("feed name %q is reserved", feed.Name)
+		}
+		if strings.SplitN(feed.Category, "/", 2)[0] == newArticleDirectory {
+			return fmt.Errorf("feed %q: category %q is reserved", feed.Name, feed.Category)
+		}
+	}
+
+	for _, feed := range feeds {
+		if feed.Directory != "" {
+			continue
+		}
+		feedPath := path.Join(feed.Category, feed.Name)
+		for _, other := range feeds {
+			if other.Category == feedPath || strings.HasPrefix(other.Category, feedPath+"/") {
+				return fmt.Errorf("feed %q clashes with category %q of feed %q", feed.Name, other.Category, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFeedDirectories rejects explicit feed directories that equal or
+// contain feed_directory, the new article directory or the directory of
+// another feed, or that lie inside the new article directory, which is
+// emptied on every update.
+func validateFeedDirectories(feeds []Feed) error {
+	newDir := filepath.Join(Config.FeedDirectory, newArticleDirectory)
+	for _, feed := range feeds {
+		if feed.Directory == "" {
+			continue
+		}
+
+		protected := []struct{ path, what string }{
+			{Config.FeedDirectory, "feed_directory"},
+			{newDir, "the new article directory"},
+		}
+		for _, other := range feeds {
+			if other.Name != feed.Name {
+				protected = append(protected, struct{ path, what string }{other.dir(), fmt.Sprintf("the directory of feed %q", other.Name)})
+			}
+		}
+		for _, p := range protected {
+			if pathContains(feed.Directory, p.path) {
+				return fmt.Errorf("feed %q: directory %s contains %s", feed.Name, feed.Directory, p.what)
+			}
+		}
+		if pathContains(newDir, feed.Directory) {
+			return fmt.Errorf("feed %q: directory %s is inside the new article directory", feed.Name, feed.Directory)
+		}
+	}
+	return nil
+}
+
+// pathContains reports whether target is dir or lies inside it.
+func pathContains(dir, target string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// loadFeedOptions returns defaults overridden by any feed settings present in
+// section.
+func loadFeedOptions(section *ini.Section, defaults FeedOptions) (FeedOptions, error) {
+	opts := defaults
+	var err error
+
+	if format := strings.TrimSpace(section.Key("format").String()); format != "" {
+		if _, ok := articleFormats[format]; !ok {
+			return opts, fmt.Errorf("unknown format %q", format)
+		}
+		opts.Format = format
+	}
+	if images := strings.TrimSpace(section.Key("html_images").String()); images != "" {
+		switch images {
+		case htmlImagesRemote, htmlImagesInline, htmlImagesLocal:
+			opts.HTMLImages = images
+		default:
+			return opts, fmt.Errorf("invalid html_images %q: expected remote, inline or local", images)
+		}
+	}
+	if template := strings.TrimSpace(section.Key("filename_template").String()); template != "" {
+		if err := validateFilenameTemplate(template); err != nil {
+			return opts, err
+		}
+		opts.FilenameTemplate = template
+	}
+	if opts.DatePrefix, err = boolSetting(section, "date_prefix", defaults.DatePrefix); err != nil {
+		return opts, err
+	}
+	if opts.FullText, err = boolSetting(section, "fulltext", defaults.FullText); err != nil {
+		return opts, err
+	}
+	if opts.Enclosures, err = boolSetting(section, "enclosures", defaults.Enclosures); err != nil {
+		return opts, err
+	}
+	if section.HasKey("enclosure_types") {
+		opts.EnclosureTypes = nil
+		for _, pattern := range strings.Split(section.Key("enclosure_types").String(), ",") {
+			if pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern != "" {
+				opts.EnclosureTypes = append(opts.EnclosureTypes, pattern)
+			}
+		}
+	}
+	if opts.EnclosureMaxSize, err = sizeSetting(section, "enclosure_max_size", defaults.EnclosureMaxSize); err != nil {
+		return opts, err
+	}
+	if opts.KeepEnclosures, err = intSetting(section, "keep_enclosures", 0, defaults.KeepEnclosures); err != nil {
+		return opts, err
+	}
+	if opts.Interval, err = durationSetting(section, "interval", defaults.Interval); err != nil {
+		return opts, err
+	}
+	if opts.Include, err = regexpSetting(section, "include", defaults.Include); err != nil {
+		return opts, err
+	}
+	if opts.Exclude, err = regexpSetting(section, "exclude", defaults.Exclude); err != nil {
+		return opts, err
+	}
+	if opts.MaxArticles, err = intSetting(section, "max_articles", 0, defaults.MaxArticles); err != nil {
+		return opts, err
+	}
+	if opts.MaxAge, err = durationSetting(section, "max_age", defaults.MaxAge); err != nil {
+		return opts, err
+	}
+	if opts.HTTP, err = loadHTTPOptions(section, defaults.HTTP); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+func intSetting(section *ini.Section, key string, min, fallback int) (int, error) {
+	raw := strings.TrimSpace(section.Key(key).String())
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min {
+		return 0, fmt.Errorf("invalid %s %q: expected an integer of at least %d", key, raw, min)
+	}
+	return value, nil
+}
+
+func boolSetting(section *ini.Section, key string, fallback bool) (bool, error) {
+	raw := strings.TrimSpace(section.Key(key).String())
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: expected true or false", key, raw)
+	}
+	return value, nil
+}
+
+func sizeSetting(section *ini.Section, key string, fallback int64) (int64, error) {
+	raw := strings.TrimSpace(section.Key(key).String())
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := parseSize(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a size such as 500K, 200M or 2G", key, raw)
+	}
+	return value, nil
+}
+
+// parseSize parses a number of bytes with an optional binary unit suffix
+// such as "K", "MB" or "GiB".
+func parseSize(raw string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	unit := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		if unit > 1 {
+			s = s[:n-1]
+		}
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return value * unit, nil
+}
+
+func durationSetting(section *ini.Section, key string, fallback time.Duration) (time.Duration, error) {
+	raw := strings.TrimSpace(section.Key(key).String())
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := parseDuration(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a duration such as 500ms, 2h or 30d", key, raw)
+	}
+	return value, nil
+}
+
+// parseDuration extends time.ParseDuration with whole days ("30d") and
+// weeks ("2w").
+func parseDuration(raw string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if !strings.HasSuffix(raw, suffix) {
+			continue
+		}
+		if count, err := strconv.Atoi(strings.TrimSuffix(raw, suffix)); err == nil {
+			return time.Duration(count) * unit, nil
+		}
+	}
+	return time.ParseDuration(raw)
+}
+
+func regexpSetting(section *ini.Section, key string, fallback *regexp.Regexp) (*regexp.Regexp, error) {
+	raw := strings.TrimSpace(section.Key(key).String())
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := regexp.Compile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", key, raw, err)
+	}
+	return value, nil
+}
+
+// feedSectionName returns the name of the section holding settings for a
+// single feed, written as [feed "Name"] in the config file.
+func feedSectionName(name string) string {
+	return `feed "` + name + `"`
+}
+
+// unsafeFeedNameChars cannot be part of a feed name, since they would not
+// survive being written to the config file as a key in [feeds] or inside
+// [feed "Name"].
+const unsafeFeedNameChars = "=:[]#;`\""
+
+// cleanFeedName removes the characters from name that are not allowed in a
+// feed name or in a directory name, and any leading dots.
+func cleanFeedName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(unsafeFeedNameChars, r) {
+			return -1
+		}
+		return r
+	}, safeArticleName(name))
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(name), "."))
+}
+
+// validateFeedName rejects names that cleanFeedName would change.
+func validateFeedName(name string) error {
+	if name == "" {
+		return errors.New("feed name cannot be empty")
+	}
+	if cleanFeedName(name) != name {
+		return fmt.Errorf("feed name %q must not start with a dot or contain any of %s or /\\*?<>|", name, unsafeFeedNameChars)
+	}
+	return nil
+}
+
+// categoryFromFeedsSection reports whether section lists feeds by name, and
+// the category they belong to: [feeds] holds uncategorised feeds and
+// [feeds.Tech.Go] holds feeds in the category Tech/Go.
+func categoryFromFeedsSection(section string) (string, bool) {
+	if section == "feeds" {
+		return "", true
+	}
+	if !strings.HasPrefix(section, "feeds.") {
+		return "", false
+	}
+	return normaliseCategory(strings.ReplaceAll(strings.TrimPrefix(section, "feeds."), ".", "/")), true
+}
+
+// normaliseCategory turns a slash-separated category path into one that is
+// safe to use as a relative directory.
+func normaliseCategory(raw string) string {
+	var parts []string
+	for _, part := range strings.Split(raw, "/") {
+		part = safeArticleName(part)
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func feedNameFromSection(section string) (string, bool) {
+	if !strings.HasPrefix(section, `feed "`) || !strings.HasSuffix(section, `"`) || len(section) <= len(`feed ""`) {
+		return "", false
+	}
+	return section[len(`feed "`) : len(section)-1], true
+}
+
 func resolveConfigDir(home string) (string, error) {
 	override := strings.TrimSpace(os.Getenv(configEnvVar))
 	if override == "" {
@@ -122,6 +568,13 @@ func expandPath(path, home string) string {
 	return path
 }
 
+// loadINI parses a config file from source, which is a path or its
+// contents. Comments are only recognised on lines of their own, because
+// values such as cookies, passwords and CSS selectors often contain ; or #.
+func loadINI(source interface{}) (*ini.File, error) {
+	return ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, source)
+}
+
 func createDefaultConfig(path string) error {
 	cfg := ini.Empty()
 	settings := cfg.Section("settings")
@@ -145,6 +598,39 @@ func configFilePath() (string, error) {
 	return filepath.Join(cfgDir, configFileName), nil
 }
 
+// resolveFeedNames expands arguments naming a category into the names of the
+// feeds in it. Other arguments are returned unchanged.
+func (c *Configuration) resolveFeedNames(args []string) []string {
+	var names []string
+	added := map[string]bool{}
+	add := func(name string) {
+		if !added[name] {
+			added[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, arg := range args {
+		if _, ok := c.FeedByName(arg); ok {
+			add(arg)
+			continue
+		}
+
+		matched := false
+		category := normaliseCategory(arg)
+		for _, feed := range c.Feeds {
+			if feed.inCategory(category) {
+				add(feed.Name)
+				matched = true
+			}
+		}
+		if !matched {
+			add(arg)
+		}
+	}
+	return names
+}
+
 func (c *Configuration) FeedByName(name string) (Feed, bool) {
 	for _, feed := range c.Feeds {
 		if feed.Name == name {
@@ -3,7 +3,9 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-ini/ini"
 )
@@ -81,7 +83,7 @@ func TestAddFeedPersistsConfig(t *testing.T) {
 	const name = "test-feed"
 	const url = "https://example.com/feed"
 
-	if err := addFeed(name, url); err != nil {
+	if err := addFeed(name, url, ""); err != nil {
 		t.Fatalf("addFeed returned error: %v", err)
 	}
 
@@ -107,7 +109,556 @@ func TestAddFeedPersistsConfig(t *testing.T) {
 		t.Fatalf("expected config to persist feed URL %s, got %s", url, got)
 	}
 
-	if err := addFeed(name, url); err == nil {
+	if err := addFeed(name, url, ""); err == nil {
 		t.Fatalf("expected adding duplicate feed to fail")
 	}
 }
+
+func TestAddFeedNameRoundTrips(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	for _, name := range []string{"a = b", "[Tech]", "C# News", "Rock; Roll", "Say \"hi\"", "`quoted`", "../up", ".hidden", "a/b"} {
+		if err := addFeed(name, "https://example.com/"+name, ""); err == nil {
+			t.Errorf("expected feed name %q to be rejected", name)
+		}
+	}
+
+	const name = "C++ & Go's (weekly) news!"
+	if err := addFeed(name, "https://example.com/odd", "Tech"); err != nil {
+		t.Fatalf("addFeed returned error: %v", err)
+	}
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if feed, ok := Config.FeedByName(name); !ok || feed.URL != "https://example.com/odd" || feed.Category != "Tech" {
+		t.Fatalf("expected feed %q to survive reload, got %+v", name, Config.Feeds)
+	}
+}
+
+func TestLoadConfigConcurrencySettings(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "[settings]\nfeed_directory = ~/feeds\nmax_concurrency = 4\nper_host_concurrency = 1\nper_host_delay = 250ms\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if Config.MaxConcurrency != 4 || Config.PerHostConcurrency != 1 || Config.PerHostDelay != 250*time.Millisecond {
+		t.Fatalf("unexpected concurrency settings: %+v", Config)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte("[settings]\nmax_concurrency = lots\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(); err == nil {
+		t.Fatalf("expected invalid max_concurrency to be rejected")
+	}
+}
+
+func TestLoadConfigPerFeedHTTPOverrides(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "[settings]\ntimeout = 10s\nuser_agent = global-agent\n\n" +
+		"[feeds]\nFast = https://example.com/fast\nSlow = https://example.com/slow\n\n" +
+		"[feed \"Slow\"]\ntimeout = 2m\nretries = 5\nuser_agent = Mozilla/5.0 (X11; Linux x86_64) #1\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	fast, _ := Config.FeedByName("Fast")
+	if fast.HTTP.Timeout != 10*time.Second || fast.HTTP.UserAgent != "global-agent" || fast.HTTP.Retries != defaultRetries {
+		t.Fatalf("expected global HTTP options for Fast, got %+v", fast.HTTP)
+	}
+
+	slow, _ := Config.FeedByName("Slow")
+	if slow.HTTP.Timeout != 2*time.Minute || slow.HTTP.UserAgent != "Mozilla/5.0 (X11; Linux x86_64) #1" || slow.HTTP.Retries != 5 {
+		t.Fatalf("expected overridden HTTP options for Slow, got %+v", slow.HTTP)
+	}
+}
+
+func TestLoadConfigFeedSections(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "[settings]\nfeed_directory = ~/feeds\nmax_articles = 100\nexclude = (?i)sponsored\n\n" +
+		"[feeds]\nLegacy = https://example.com/legacy\n\n" +
+		"[feed \"Legacy\"]\ninterval = 2h\n\n" +
+		"[feed \"Modern\"]\nurl = https://example.com/modern\ndirectory = elsewhere\nmax_age = 30d\ninclude = ^Release\nmax_articles = 10\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	if len(Config.Feeds) != 2 {
+		t.Fatalf("expected 2 feeds, got %d", len(Config.Feeds))
+	}
+
+	legacy, _ := Config.FeedByName("Legacy")
+	if legacy.Interval != 2*time.Hour || legacy.MaxArticles != 100 || legacy.Exclude == nil {
+		t.Fatalf("expected Legacy to merge its section onto the defaults, got %+v", legacy.FeedOptions)
+	}
+	if legacy.dir() != filepath.Join(home, "feeds", "Legacy") {
+		t.Fatalf("unexpected directory for Legacy: %s", legacy.dir())
+	}
+
+	modern, ok := Config.FeedByName("Modern")
+	if !ok || modern.URL != "https://example.com/modern" {
+		t.Fatalf("expected Modern to be defined by its section, got %+v", modern)
+	}
+	if modern.MaxAge != 30*24*time.Hour || modern.MaxArticles != 10 || modern.Include == nil || modern.Format != defaultFormat {
+		t.Fatalf("unexpected options for Modern: %+v", modern.FeedOptions)
+	}
+	if modern.dir() != filepath.Join(home, "feeds", "elsewhere") {
+		t.Fatalf("expected relative directory to resolve against feed_directory, got %s", modern.dir())
+	}
+
+	invalid := "[feed \"Broken\"]\nurl = https://example.com\nformat = pdf\n"
+	if err := os.WriteFile(cfgPath, []byte(invalid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(); err == nil {
+		t.Fatalf("expected unknown format to be rejected")
+	}
+
+	invalid = "[feed \"Broken\"]\nurl = https://example.com\nfilename_template = {date} {name}\n"
+	if err := os.WriteFile(cfgPath, []byte(invalid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(); err == nil {
+		t.Fatalf("expected unknown filename_template placeholder to be rejected")
+	}
+}
+
+func TestLoadConfigRejectsUnsafeDirectories(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, directory := range []string{".", "~", "new", "new/Elsewhere", "Other", "Tech"} {
+		content := "[settings]\nfeed_directory = ~/feeds\n\n" +
+			"[feeds]\nOther = https://example.com/other\n\n" +
+			"[feeds.Tech]\nNested = https://example.com/nested\n\n" +
+			"[feed \"Own\"]\nurl = https://example.com/own\ndirectory = " + directory + "\n"
+		if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadConfig(); err == nil {
+			t.Errorf("expected directory %q to be rejected", directory)
+		}
+	}
+
+	content := "[settings]\nfeed_directory = ~/feeds\n\n" +
+		"[feed \"Own\"]\nurl = https://example.com/own\ndirectory = ~/notes/own\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("expected a separate directory to be accepted, got %v", err)
+	}
+}
+
+func TestLoadConfigDatePrefix(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "[feeds]\nDated = https://example.com/dated\nPlain = https://example.com/plain\n\n" +
+		"[feed \"Dated\"]\ndate_prefix = true\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if dated, _ := Config.FeedByName("Dated"); !dated.DatePrefix {
+		t.Errorf("expected date_prefix to be enabled for Dated")
+	}
+	if plain, _ := Config.FeedByName("Plain"); plain.DatePrefix {
+		t.Errorf("expected date_prefix to be disabled by default")
+	}
+
+	invalid := "[feed \"Broken\"]\nurl = https://example.com\ndate_prefix = sometimes\n"
+	if err := os.WriteFile(cfgPath, []byte(invalid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(); err == nil {
+		t.Fatalf("expected invalid date_prefix to be rejected")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90s": 90 * time.Second,
+		"2h":  2 * time.Hour,
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	}
+	for input, want := range tests {
+		got, err := parseDuration(input)
+		if err != nil || got != want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := parseDuration("5"); err == nil {
+		t.Errorf("expected duration without unit to be rejected")
+	}
+}
+
+func TestLoadConfigCategories(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "[settings]\nfeed_directory = ~/feeds\n\n" +
+		"[feeds]\nPlain = https://example.com/plain\n\n" +
+		"[feeds.Tech]\nHN = https://example.com/hn\n\n" +
+		"[feeds.Tech.Go]\nGoBlog = https://example.com/go\n\n" +
+		"[feed \"Comics\"]\nurl = https://example.com/comics\ncategory = Fun/../Daily\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	want := map[string]string{"Plain": "", "HN": "Tech", "GoBlog": "Tech/Go", "Comics": "Fun/Daily"}
+	for name, category := range want {
+		feed, ok := Config.FeedByName(name)
+		if !ok {
+			t.Fatalf("expected feed %q to be loaded", name)
+		}
+		if feed.Category != category {
+			t.Errorf("expected feed %q in category %q, got %q", name, category, feed.Category)
+		}
+	}
+
+	goBlog, _ := Config.FeedByName("GoBlog")
+	if goBlog.dir() != filepath.Join(home, "feeds", "Tech", "Go", "GoBlog") {
+		t.Errorf("expected categorised feed directory, got %s", goBlog.dir())
+	}
+
+	got := Config.resolveFeedNames([]string{"Tech", "HN", "Plain", "unknown"})
+	if strings.Join(got, ",") != "HN,GoBlog,Plain,unknown" {
+		t.Errorf("unexpected resolved feed names: %v", got)
+	}
+}
+
+func TestLoadConfigRejectsCategoryClashes(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{
+		"[feeds]\nnew = https://example.com/new\n",
+		"[feeds.new]\nHN = https://example.com/hn\n",
+		"[feeds]\nTech = https://example.com/tech\n\n[feeds.Tech]\nHN = https://example.com/hn\n",
+		"[feeds.Tech]\nGo = https://example.com/go\n\n[feeds.Tech.Go.Blogs]\nGoBlog = https://example.com/goblog\n",
+	} {
+		if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadConfig(); err == nil {
+			t.Errorf("expected config to be rejected:\n%s", content)
+		}
+	}
+
+	content := "[feeds]\nTech = https://example.com/tech\n\n[feed \"Tech\"]\ndirectory = ~/tech\n\n[feeds.Tech]\nHN = https://example.com/hn\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("expected a feed with its own directory not to clash, got %v", err)
+	}
+
+	if err := addFeed("Go", "https://example.com/go", "Tech/Blogs"); err != nil {
+		t.Fatalf("addFeed returned error: %v", err)
+	}
+	if err := addFeed("HN", "https://example.com/other", "Tech/HN/Comments"); err == nil {
+		t.Fatal("expected adding a category inside a feed's directory to fail")
+	}
+	if err := addFeed("new", "https://example.com/new", ""); err == nil {
+		t.Fatal("expected the name new to be reserved")
+	}
+	if err := renameFeed("Go", "Tech"); err == nil {
+		t.Fatal("expected renaming a feed to an existing name to fail")
+	}
+	if err := renameFeed("HN", "Blogs"); err == nil {
+		t.Fatal("expected renaming a feed onto a category to fail")
+	}
+}
+
+func TestAddFeedWithCategory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	if err := addFeed("go-blog", "https://go.dev/blog/feed.atom", "Tech/Go"); err != nil {
+		t.Fatalf("addFeed returned error: %v", err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	feed, ok := Config.FeedByName("go-blog")
+	if !ok || feed.Category != "Tech/Go" || feed.URL != "https://go.dev/blog/feed.atom" {
+		t.Fatalf("expected categorised feed to survive reload, got %+v", feed)
+	}
+
+	if err := addFeed("go-blog", "https://go.dev/blog/feed.atom", ""); err == nil {
+		t.Fatalf("expected adding feed with the name of a sectioned feed to fail")
+	}
+}
+
+func TestRemoveFeed(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if err := addFeed("keep", "https://example.com/keep", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFeed("drop", "https://example.com/drop", "Tech"); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, _ := Config.FeedByName("drop")
+	articlePath := filepath.Join(feed.dir(), "Article")
+	if err := os.MkdirAll(feed.dir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(articlePath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatal(err)
+	}
+	linkNewArticle(feed, "Article", articlePath, nil)
+
+	if err := removeFeed("drop", true); err != nil {
+		t.Fatalf("removeFeed returned error: %v", err)
+	}
+	if _, err := os.Stat(feed.dir()); !os.IsNotExist(err) {
+		t.Fatalf("expected feed directory to be deleted")
+	}
+	if _, err := os.Lstat(feed.newLinkPath("Article")); !os.IsNotExist(err) {
+		t.Fatalf("expected new symlink to be removed")
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if _, ok := Config.FeedByName("drop"); ok {
+		t.Fatalf("expected removed feed to be gone from the config")
+	}
+	if _, ok := Config.FeedByName("keep"); !ok {
+		t.Fatalf("expected other feeds to be kept")
+	}
+
+	if err := removeFeed("missing", false); err == nil {
+		t.Fatalf("expected removing unknown feed to fail")
+	}
+}
+
+func TestRenameFeed(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if err := addFeed("old", "https://example.com/feed", "Tech"); err != nil {
+		t.Fatal(err)
+	}
+	if err := addFeed("other", "https://example.com/other", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, _ := Config.FeedByName("old")
+	articlePath := filepath.Join(feed.dir(), "Article")
+	if err := os.MkdirAll(feed.dir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(articlePath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatal(err)
+	}
+	linkNewArticle(feed, "Article", articlePath, nil)
+
+	if err := renameFeed("old", "other"); err == nil {
+		t.Fatalf("expected renaming onto an existing feed to fail")
+	}
+	if err := renameFeed("old", "new-name"); err != nil {
+		t.Fatalf("renameFeed returned error: %v", err)
+	}
+
+	renamed, ok := Config.FeedByName("new-name")
+	if !ok {
+		t.Fatalf("expected renamed feed in memory")
+	}
+	if _, err := os.Stat(filepath.Join(renamed.dir(), "Article")); err != nil {
+		t.Fatalf("expected article to move with the feed: %v", err)
+	}
+	target, err := os.Readlink(renamed.newLinkPath("Article"))
+	if err != nil || target != filepath.Join(renamed.dir(), "Article") {
+		t.Fatalf("expected new symlink to follow the move, got %q (%v)", target, err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	reloaded, ok := Config.FeedByName("new-name")
+	if !ok || reloaded.Category != "Tech" || reloaded.URL != "https://example.com/feed" {
+		t.Fatalf("expected renamed feed with its settings in the config, got %+v", reloaded)
+	}
+	if _, ok := Config.FeedByName("old"); ok {
+		t.Fatalf("expected old name to be gone from the config")
+	}
+}
+
+func TestSetFeedURL(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if err := addFeed("feed", "https://example.com/old", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, _ := Config.FeedByName("feed")
+	if err := os.MkdirAll(feed.dir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	state := newFeedState()
+	state.ETag = `"v1"`
+	if err := state.save(feed.dir()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setFeedURL("feed", "https://example.com/new"); err != nil {
+		t.Fatalf("setFeedURL returned error: %v", err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if feed, _ := Config.FeedByName("feed"); feed.URL != "https://example.com/new" {
+		t.Fatalf("expected new URL to be persisted, got %q", feed.URL)
+	}
+	if state, err := loadFeedState(feed.dir()); err != nil || state.ETag != "" {
+		t.Fatalf("expected cached validators to be cleared, got %+v (%v)", state, err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":   512,
+		"100B":  100,
+		"500K":  500 << 10,
+		"200MB": 200 << 20,
+		"2GiB":  2 << 30,
+		"1 t":   1 << 40,
+	}
+	for input, want := range tests {
+		got, err := parseSize(input)
+		if err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "M", "1.5G", "lots"} {
+		if _, err := parseSize(input); err == nil {
+			t.Errorf("expected parseSize(%q) to fail", input)
+		}
+	}
+}
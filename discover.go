@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+)
+
+// feedLinkTypes are the media types of <link rel="alternate"> tags that
+// point to a feed.
+var feedLinkTypes = map[string]string{
+	"application/rss+xml":   "RSS",
+	"application/atom+xml":  "Atom",
+	"application/feed+json": "JSON Feed",
+}
+
+// feedCandidate is a feed an HTML page links to.
+type feedCandidate struct {
+	URL   string
+	Title string
+	Type  string
+}
+
+// fetchedDocument is a page or feed downloaded by fetchDocument.
+type fetchedDocument struct {
+	URL         *url.URL
+	ContentType string
+	Body        []byte
+}
+
+func (d *fetchedDocument) isHTML() bool {
+	mediaType, _, _ := mime.ParseMediaType(d.ContentType)
+	if mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(d.Body))
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// fetchDocument downloads rawURL with the default HTTP options.
+func fetchDocument(rawURL string) (*fetchedDocument, error) {
+	opts := Config.Defaults.HTTP
+	client, err := httpClientFor(opts)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, text/html;q=0.8, */*;q=0.1")
+
+	resp, err := doWithRetry(client, req, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return &fetchedDocument{URL: resp.Request.URL, ContentType: resp.Header.Get("Content-Type"), Body: body}, nil
+}
+
+// resolveFeed returns the feed to add for rawURL. If rawURL is a feed it is
+// returned as is. If it is an HTML page, the feeds the page links to are
+// listed, one of them is chosen with choose and it must parse as a feed.
+// It fails if rawURL cannot be fetched or is neither.
+func resolveFeed(rawURL string, choose func([]feedCandidate) (int, error)) (string, *gofeed.Feed, error) {
+	doc, err := fetchDocument(rawURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch %s: %w", rawURL, err)
+	}
+
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(doc.Body))
+	if err == nil {
+		return rawURL, feed, nil
+	}
+	if !doc.isHTML() {
+		return "", nil, fmt.Errorf("parse feed %s: %w", rawURL, err)
+	}
+
+	candidates, err := discoverFeeds(doc)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(candidates) == 0 {
+		return "", nil, fmt.Errorf("%s is an HTML page that does not link to any feeds", rawURL)
+	}
+	choice, err := choose(candidates)
+	if err != nil {
+		return "", nil, err
+	}
+	candidate := candidates[choice]
+
+	doc, err = fetchDocument(candidate.URL)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch feed %s: %w", candidate.URL, err)
+	}
+	feed, err = gofeed.NewParser().Parse(bytes.NewReader(doc.Body))
+	if err != nil {
+		return "", nil, fmt.Errorf("parse feed %s: %w", candidate.URL, err)
+	}
+	return candidate.URL, feed, nil
+}
+
+// discoverFeeds returns the feeds an HTML page advertises with
+// <link rel="alternate"> tags, in the order they appear.
+func discoverFeeds(doc *fetchedDocument) ([]feedCandidate, error) {
+	page, err := goquery.NewDocumentFromReader(bytes.NewReader(doc.Body))
+	if err != nil {
+		return nil, fmt.Errorf("parse page: %w", err)
+	}
+
+	base := doc.URL
+	if href, ok := page.Find("base[href]").First().Attr("href"); ok {
+		if resolved, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			base = resolved
+		}
+	}
+
+	var candidates []feedCandidate
+	seen := map[string]bool{}
+	page.Find("link[rel][href][type]").Each(func(_ int, link *goquery.Selection) {
+		if !hasToken(link.AttrOr("rel", ""), "alternate") {
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(link.AttrOr("type", ""))
+		kind, ok := feedLinkTypes[mediaType]
+		if !ok {
+			return
+		}
+		resolved, err := base.Parse(strings.TrimSpace(link.AttrOr("href", "")))
+		if err != nil || resolved.Scheme != "http" && resolved.Scheme != "https" || seen[resolved.String()] {
+			return
+		}
+		seen[resolved.String()] = true
+		candidates = append(candidates, feedCandidate{
+			URL:   resolved.String(),
+			Title: collapseWhitespace(strings.TrimSpace(link.AttrOr("title", ""))),
+			Type:  kind,
+		})
+	})
+	return candidates, nil
+}
+
+// hasToken reports whether the space-separated list s contains token,
+// ignoring case.
+func hasToken(s, token string) bool {
+	for _, field := range strings.Fields(s) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseCandidate lists the candidates on out and returns the index of the
+// one to add: the 1-based pick if given, the only candidate, or the answer
+// to a prompt read from in when interactive.
+func chooseCandidate(candidates []feedCandidate, pick int, interactive bool, in io.Reader, out io.Writer) (int, error) {
+	fmt.Fprintf(out, "Found %d feeds:\n", len(candidates))
+	for i, candidate := range candidates {
+		title := candidate.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		fmt.Fprintf(out, "  %d. %s [%s] %s\n", i+1, title, candidate.Type, candidate.URL)
+	}
+
+	switch {
+	case pick > 0:
+		if pick > len(candidates) {
+			return 0, fmt.Errorf("--pick %d is out of range: found %d feeds", pick, len(candidates))
+		}
+		return pick - 1, nil
+	case len(candidates) == 1:
+		return 0, nil
+	case !interactive:
+		return 0, errors.New("found several feeds - choose one with --pick")
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Pick a feed [1-%d]: ", len(candidates))
+		line, err := reader.ReadString('\n')
+		if n, convErr := strconv.Atoi(strings.TrimSpace(line)); convErr == nil && n >= 1 && n <= len(candidates) {
+			return n - 1, nil
+		}
+		if err != nil {
+			return 0, errors.New("no feed picked")
+		}
+	}
+}
+
+// suggestFeedName returns a feed name derived from the feed's title, or from
+// the host of feedURL if the feed has no usable title.
+func suggestFeedName(feed *gofeed.Feed, feedURL string) string {
+	if feed != nil {
+		if name := strings.Join(strings.Fields(cleanFeedName(collapseWhitespace(feed.Title))), " "); name != "" {
+			return truncateString(name, maxFileNameLength)
+		}
+	}
+	if parsed, err := url.Parse(feedURL); err == nil {
+		return strings.TrimPrefix(parsed.Hostname(), "www.")
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestResolveFeedDiscoversLinkedFeeds(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(configEnvVar, "")
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blog/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html><head>
+<link rel="stylesheet" type="text/css" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="Posts" href="feed.xml">
+<link rel="Alternate" type="application/atom+xml" title="Comments" href="/comments.atom">
+<link rel="alternate" type="application/rss+xml" href="feed.xml">
+<link rel="alternate" hreflang="de" type="text/html" href="/de/">
+</head><body>Blog</body></html>`))
+		case "/blog/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>My Blog</title></channel></rss>`))
+		case "/comments.atom":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(`not a feed`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	var offered []feedCandidate
+	feedURL, feed, err := resolveFeed(server.URL+"/blog/", func(candidates []feedCandidate) (int, error) {
+		offered = candidates
+		return 0, nil
+	})
+	if err != nil {
+		t.Fatalf("resolveFeed returned error: %v", err)
+	}
+	want := []feedCandidate{
+		{URL: server.URL + "/blog/feed.xml", Title: "Posts", Type: "RSS"},
+		{URL: server.URL + "/comments.atom", Title: "Comments", Type: "Atom"},
+	}
+	if len(offered) != len(want) || offered[0] != want[0] || offered[1] != want[1] {
+		t.Fatalf("expected candidates %+v, got %+v", want, offered)
+	}
+	if feedURL != want[0].URL || feed == nil || feed.Title != "My Blog" {
+		t.Fatalf("expected the first candidate to be resolved, got %s %+v", feedURL, feed)
+	}
+
+	if _, _, err := resolveFeed(server.URL+"/blog/", func([]feedCandidate) (int, error) { return 1, nil }); err == nil {
+		t.Fatal("expected a candidate that does not parse to be rejected")
+	}
+
+	direct, feed, err := resolveFeed(server.URL+"/blog/feed.xml", func([]feedCandidate) (int, error) {
+		t.Fatal("a feed URL should not offer candidates")
+		return 0, nil
+	})
+	if err != nil || direct != server.URL+"/blog/feed.xml" || feed == nil {
+		t.Fatalf("expected feed URL to resolve to itself, got %s %+v %v", direct, feed, err)
+	}
+}
+
+func TestResolveFeedPageWithoutFeeds(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(configEnvVar, "")
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<!DOCTYPE html><html><head><title>Home</title></head><body>Nothing here</body></html>`))
+	}))
+	t.Cleanup(server.Close)
+
+	if _, _, err := resolveFeed(server.URL, func([]feedCandidate) (int, error) { return 0, nil }); err == nil {
+		t.Fatal("expected an error for a page without feeds")
+	}
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("not a feed"))
+	}))
+	t.Cleanup(plain.Close)
+
+	if _, _, err := resolveFeed(plain.URL, func([]feedCandidate) (int, error) { return 0, nil }); err == nil {
+		t.Fatal("expected an error for a URL that is neither a feed nor a page")
+	}
+}
+
+func TestChooseCandidate(t *testing.T) {
+	candidates := []feedCandidate{
+		{URL: "https://example.com/feed.xml", Title: "Posts", Type: "RSS"},
+		{URL: "https://example.com/feed.json", Type: "JSON Feed"},
+	}
+
+	var out bytes.Buffer
+	if got, err := chooseCandidate(candidates, 2, false, strings.NewReader(""), &out); err != nil || got != 1 {
+		t.Fatalf("expected --pick 2 to choose index 1, got %d, %v", got, err)
+	}
+	if !strings.Contains(out.String(), "2. (untitled) [JSON Feed] https://example.com/feed.json") {
+		t.Fatalf("expected candidates to be listed, got:\n%s", out.String())
+	}
+
+	if _, err := chooseCandidate(candidates, 3, false, strings.NewReader(""), &out); err == nil {
+		t.Fatal("expected an out of range pick to be rejected")
+	}
+	if _, err := chooseCandidate(candidates, 0, false, strings.NewReader(""), &out); err == nil {
+		t.Fatal("expected several candidates to require --pick when not interactive")
+	}
+	if got, err := chooseCandidate(candidates[:1], 0, false, strings.NewReader(""), &out); err != nil || got != 0 {
+		t.Fatalf("expected a single candidate to be chosen, got %d, %v", got, err)
+	}
+	if got, err := chooseCandidate(candidates, 0, true, strings.NewReader("x\n7\n2\n"), &out); err != nil || got != 1 {
+		t.Fatalf("expected the prompt to ask until a valid answer, got %d, %v", got, err)
+	}
+	if _, err := chooseCandidate(candidates, 0, true, strings.NewReader("x\n"), &out); err == nil {
+		t.Fatal("expected an error when input ends without a valid answer")
+	}
+}
+
+func TestSuggestFeedName(t *testing.T) {
+	tests := []struct {
+		title string
+		url   string
+		want  string
+	}{
+		{title: "  The Go\n Blog ", url: "https://go.dev/blog/feed.atom", want: "The Go Blog"},
+		{title: "News: Tech/Science", url: "https://example.com/rss", want: "News TechScience"},
+		{title: "", url: "https://www.example.com/rss", want: "example.com"},
+		{title: "[Weekly] C# = \"news\"; #1", url: "https://example.com/rss", want: "Weekly C news 1"},
+		{title: "[]#;", url: "https://example.com/rss", want: "example.com"},
+	}
+	for _, tt := range tests {
+		if got := suggestFeedName(&gofeed.Feed{Title: tt.title}, tt.url); got != tt.want {
+			t.Errorf("suggestFeedName(%q, %q) = %q, want %q", tt.title, tt.url, got, tt.want)
+		}
+	}
+}
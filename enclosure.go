@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+)
+
+// storedEnclosure is a media file attached to an item that is downloaded
+// into the feed directory as File. Enclosures that will not be downloaded,
+// e.g. because they turned out to be too large, record the reason in
+// Skipped.
+type storedEnclosure struct {
+	URL      string `json:"url"`
+	Type     string `json:"type,omitempty"`
+	File     string `json:"file,omitempty"`
+	Complete bool   `json:"complete,omitempty"`
+	Skipped  string `json:"skipped,omitempty"`
+}
+
+func (e *storedEnclosure) pending() bool {
+	return e.File != "" && !e.Complete && e.Skipped == ""
+}
+
+// enclosureExtensions maps common media types to file extensions, for
+// enclosures whose URL does not end in one.
+var enclosureExtensions = map[string]string{
+	"audio/mpeg":  ".mp3",
+	"audio/mp4":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/aac":   ".aac",
+	"audio/ogg":   ".ogg",
+	"audio/opus":  ".opus",
+	"audio/flac":  ".flac",
+	"audio/wav":   ".wav",
+	"video/mp4":   ".mp4",
+	"video/webm":  ".webm",
+	"video/ogg":   ".ogv",
+	"video/x-m4v": ".m4v",
+}
+
+var fileExtension = regexp.MustCompile(`^\.[A-Za-z0-9]{1,5}$`)
+
+// permanentError marks download failures that are not retried.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// wantsEnclosureType reports whether enclosures of the given media type are
+// downloaded for the feed.
+func (f Feed) wantsEnclosureType(mediaType string) bool {
+	if len(f.EnclosureTypes) == 0 {
+		return true
+	}
+	mediaType = strings.ToLower(mediaType)
+	for _, pattern := range f.EnclosureTypes {
+		if strings.HasSuffix(pattern, "/*") {
+			if strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// planEnclosures returns the enclosures of item the feed downloads, each
+// given a file name in feedDir derived from base that is not yet claimed.
+func planEnclosures(feed Feed, feedDir string, item *gofeed.Item, base string, claimed map[string]bool) []*storedEnclosure {
+	var planned []*storedEnclosure
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil || strings.TrimSpace(enclosure.URL) == "" {
+			continue
+		}
+		enclosureURL := strings.TrimSpace(enclosure.URL)
+
+		mediaType, _, _ := mime.ParseMediaType(enclosure.Type)
+		ext := enclosureExtension(enclosureURL, mediaType)
+		if mediaType == "" && ext != "" {
+			mediaType, _, _ = mime.ParseMediaType(mime.TypeByExtension(ext))
+		}
+		if !feed.wantsEnclosureType(mediaType) {
+			log.Debugf("Enclosure %s of type %q in feed '%s' excluded by enclosure_types", enclosureURL, mediaType, feed.Name)
+			continue
+		}
+		if length, err := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64); err == nil &&
+			feed.EnclosureMaxSize > 0 && length > feed.EnclosureMaxSize {
+			log.Debugf("Enclosure %s in feed '%s' exceeds enclosure_max_size", enclosureURL, feed.Name)
+			continue
+		}
+
+		file := uniqueArticleName(feedDir, truncateString(base, maxFileNameLength-len(ext)), ext, claimed)
+		claimed[file] = true
+		planned = append(planned, &storedEnclosure{URL: enclosureURL, Type: mediaType, File: file})
+	}
+	return planned
+}
+
+// enclosureExtension returns the file extension for an enclosure, taken from
+// its URL or else from its media type.
+func enclosureExtension(rawURL, mediaType string) string {
+	if parsed, err := url.Parse(rawURL); err == nil {
+		if ext := path.Ext(parsed.Path); fileExtension.MatchString(ext) {
+			return strings.ToLower(ext)
+		}
+	}
+	if ext, ok := enclosureExtensions[mediaType]; ok {
+		return ext
+	}
+	return imageExtensions[mediaType]
+}
+
+// downloadEnclosures downloads the pending enclosures of the feed's items,
+// newest first. When keep_enclosures is set, the enclosures of all but the
+// newest that many items are removed instead. Every download takes a slot
+// of hosts, if given. It returns the number of completed downloads.
+func downloadEnclosures(feed Feed, feedDir string, state *feedState, hosts *hostLimiter) int {
+	var items []*seenItem
+	for _, seen := range state.Items {
+		for _, enclosure := range seen.Enclosures {
+			if enclosure.File != "" && enclosure.Skipped == "" {
+				items = append(items, seen)
+				break
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].date().After(items[j].date())
+	})
+
+	downloaded := 0
+	for i, seen := range items {
+		if feed.KeepEnclosures > 0 && i >= feed.KeepEnclosures {
+			removeEnclosures(feedDir, seen)
+			continue
+		}
+		for _, enclosure := range seen.Enclosures {
+			if !enclosure.pending() {
+				continue
+			}
+			release := hosts.acquire(feedHost(enclosure.URL))
+			err := downloadEnclosure(feed, feedDir, enclosure, seen.Published)
+			release()
+			if err != nil {
+				var permanent *permanentError
+				if errors.As(err, &permanent) {
+					enclosure.Skipped = err.Error()
+					os.Remove(enclosurePartPath(feedDir, enclosure.URL))
+				}
+				log.WithError(err).Warnf("Failed to download enclosure %s of feed '%s'", enclosure.URL, feed.Name)
+				continue
+			}
+			enclosure.Complete = true
+			downloaded++
+			log.Infof("Downloaded enclosure '%s' of feed '%s'", enclosure.File, feed.Name)
+		}
+	}
+	return downloaded
+}
+
+// removeEnclosures deletes the downloaded and partially downloaded
+// enclosures of an item.
+func removeEnclosures(feedDir string, seen *seenItem) {
+	for _, enclosure := range seen.Enclosures {
+		if enclosure.File == "" {
+			continue
+		}
+		enclosurePath := filepath.Join(feedDir, enclosure.File)
+		if err := os.Remove(enclosurePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.WithError(err).Warnf("Failed to remove enclosure %s", enclosurePath)
+			continue
+		}
+		os.Remove(enclosurePartPath(feedDir, enclosure.URL))
+		log.Debugf("Removed enclosure %s", enclosurePath)
+		enclosure.File = ""
+		enclosure.Complete = false
+	}
+}
+
+// enclosurePartPath returns where an enclosure is kept while it is being
+// downloaded.
+func enclosurePartPath(feedDir, enclosureURL string) string {
+	sum := sha256.Sum256([]byte(enclosureURL))
+	return filepath.Join(feedDir, ".rssnix-"+hex.EncodeToString(sum[:8])+".part")
+}
+
+// downloadEnclosure downloads an enclosure, resuming a previous partial
+// download if the server supports range requests. The feed's timeout limits
+// how long the transfer may stall rather than its total duration.
+func downloadEnclosure(feed Feed, feedDir string, enclosure *storedEnclosure, date *time.Time) error {
+	partPath := enclosurePartPath(feedDir, enclosure.URL)
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	// The stall timer only starts once the response has arrived, so that
+	// waiting for a retry does not count as a stall; until then the feed's
+	// timeout limits each attempt's wait for the response headers.
+	opts := feed.HTTP
+	stall := opts.Timeout
+	opts.Timeout = 0
+	opts.HeaderTimeout = stall
+	client, err := httpClientFor(opts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expectedRange := "bytes " + strconv.FormatInt(offset, 10) + "-"
+	var resp *http.Response
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, enclosure.URL, nil)
+		if err != nil {
+			return &permanentError{err}
+		}
+		if err := feed.authorize(req); err != nil {
+			return err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		}
+
+		resp, err = doWithRetry(client, req, opts)
+		if err != nil {
+			return err
+		}
+		if offset == 0 || resp.StatusCode != http.StatusPartialContent ||
+			strings.HasPrefix(resp.Header.Get("Content-Range"), expectedRange) {
+			break
+		}
+
+		// The server sent a different part than was asked for, so the
+		// partial download cannot be resumed.
+		resp.Body.Close()
+		if err := os.Remove(partPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		offset = 0
+	}
+	defer resp.Body.Close()
+
+	body := &stallReader{r: resp.Body, timeout: stall}
+	if stall > 0 {
+		body.timer = time.AfterFunc(stall, cancel)
+		defer body.timer.Stop()
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags = os.O_WRONLY | os.O_APPEND
+	case resp.StatusCode == http.StatusPartialContent:
+		return fmt.Errorf("unexpected partial content %s", resp.Header.Get("Content-Range"))
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The previous download was complete but not yet moved into place.
+		return finishEnclosure(partPath, filepath.Join(feedDir, enclosure.File), date)
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		offset = 0
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return &permanentError{fmt.Errorf("unexpected status %s", resp.Status)}
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	limit := int64(-1)
+	if feed.EnclosureMaxSize > 0 {
+		limit = feed.EnclosureMaxSize - offset
+		if resp.ContentLength > limit {
+			return &permanentError{fmt.Errorf("enclosure larger than %d bytes", feed.EnclosureMaxSize)}
+		}
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0o666)
+	if err != nil {
+		return err
+	}
+	var src io.Reader = body
+	if limit >= 0 {
+		src = io.LimitReader(body, limit+1)
+	}
+	written, err := io.Copy(file, src)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if limit >= 0 && written > limit {
+		return &permanentError{fmt.Errorf("enclosure larger than %d bytes", feed.EnclosureMaxSize)}
+	}
+
+	return finishEnclosure(partPath, filepath.Join(feedDir, enclosure.File), date)
+}
+
+func finishEnclosure(partPath, enclosurePath string, date *time.Time) error {
+	if err := os.Rename(partPath, enclosurePath); err != nil {
+		return err
+	}
+	if date != nil {
+		os.Chtimes(enclosurePath, time.Now(), *date)
+	}
+	return nil
+}
+
+// stallReader resets timer whenever data arrives, so that the timer only
+// fires once the transfer has stalled for timeout.
+type stallReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 && s.timer != nil {
+		s.timer.Reset(s.timeout)
+	}
+	return n, err
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWantsEnclosureType(t *testing.T) {
+	feed := Feed{FeedOptions: FeedOptions{EnclosureTypes: []string{"audio/*", "video/mp4"}}}
+	tests := map[string]bool{
+		"audio/mpeg": true,
+		"AUDIO/OGG":  true,
+		"video/mp4":  true,
+		"video/webm": false,
+		"":           false,
+	}
+	for mediaType, want := range tests {
+		if got := feed.wantsEnclosureType(mediaType); got != want {
+			t.Errorf("wantsEnclosureType(%q) = %v, want %v", mediaType, got, want)
+		}
+	}
+	if !(Feed{}).wantsEnclosureType("application/pdf") {
+		t.Errorf("expected all types to be wanted without enclosure_types")
+	}
+}
+
+func TestEnclosureExtension(t *testing.T) {
+	tests := []struct {
+		url       string
+		mediaType string
+		want      string
+	}{
+		{"https://example.com/episode.MP3?token=1", "audio/mpeg", ".mp3"},
+		{"https://example.com/download/123", "audio/mp4", ".m4a"},
+		{"https://example.com/v1.2/stream", "video/webm", ".webm"},
+		{"https://example.com/file", "", ""},
+	}
+	for _, tc := range tests {
+		if got := enclosureExtension(tc.url, tc.mediaType); got != tc.want {
+			t.Errorf("enclosureExtension(%q, %q) = %q, want %q", tc.url, tc.mediaType, got, tc.want)
+		}
+	}
+}
+
+func TestDownloadEnclosureResumes(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "episode.mp3", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	enclosure := &storedEnclosure{URL: server.URL + "/episode.mp3", File: "Episode.mp3"}
+	if err := os.WriteFile(enclosurePartPath(dir, enclosure.URL), content[:4000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := Feed{FeedOptions: FeedOptions{HTTP: defaultHTTPOptions()}}
+	if err := downloadEnclosure(feed, dir, enclosure, nil); err != nil {
+		t.Fatalf("downloadEnclosure returned error: %v", err)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=4000-" {
+		t.Fatalf("expected a range request resuming the download, got %q", ranges)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "Episode.mp3"))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("expected the complete enclosure, got %d bytes (%v)", len(data), err)
+	}
+	if _, err := os.Stat(enclosurePartPath(dir, enclosure.URL)); !os.IsNotExist(err) {
+		t.Fatalf("expected partial download to be moved into place")
+	}
+
+	feed.EnclosureMaxSize = 100
+	enclosure = &storedEnclosure{URL: server.URL + "/large.mp3", File: "Large.mp3"}
+	err = downloadEnclosure(feed, dir, enclosure, nil)
+	if _, ok := err.(*permanentError); !ok {
+		t.Fatalf("expected a permanent error for an enclosure over the size limit, got %v", err)
+	}
+}
+
+func TestDownloadEnclosureRestartsOnUnexpectedRange(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") != "" {
+			// Ignore the requested offset and send the start instead.
+			w.Header().Set("Content-Range", "bytes 0-99/10000")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[:100])
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	enclosure := &storedEnclosure{URL: server.URL + "/episode.mp3", File: "Episode.mp3"}
+	if err := os.WriteFile(enclosurePartPath(dir, enclosure.URL), content[:4000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := Feed{FeedOptions: FeedOptions{HTTP: defaultHTTPOptions()}}
+	if err := downloadEnclosure(feed, dir, enclosure, nil); err != nil {
+		t.Fatalf("downloadEnclosure returned error: %v", err)
+	}
+	if len(ranges) != 2 || ranges[0] != "bytes=4000-" || ranges[1] != "" {
+		t.Fatalf("expected the download to start over without a range, got %q", ranges)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "Episode.mp3"))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("expected the complete enclosure, got %d bytes (%v)", len(data), err)
+	}
+}
+
+func TestDownloadEnclosureStallTimerIgnoresRetryWait(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("episode"))
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	enclosure := &storedEnclosure{URL: server.URL + "/episode.mp3", File: "Episode.mp3"}
+	opts := defaultHTTPOptions()
+	opts.Timeout = 200 * time.Millisecond
+	feed := Feed{FeedOptions: FeedOptions{HTTP: opts}}
+	if err := downloadEnclosure(feed, dir, enclosure, nil); err != nil {
+		t.Fatalf("expected a Retry-After wait longer than the timeout to be tolerated, got %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "Episode.mp3")); err != nil || string(data) != "episode" {
+		t.Fatalf("expected the enclosure to be downloaded, got %q (%v)", data, err)
+	}
+}
+
+func TestUpdateFeedDownloadsEnclosures(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	var server *httptest.Server
+	items := []string{"1", "2"}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/media/") {
+			_, _ = w.Write([]byte("media " + r.URL.Path))
+			return
+		}
+		var body strings.Builder
+		body.WriteString(`<rss version="2.0"><channel><title>Podcast</title>`)
+		for _, n := range items {
+			body.WriteString(`<item><title>Episode ` + n + `</title><guid>` + n + `</guid>` +
+				`<pubDate>Mon, 0` + n + ` Jan 2006 15:04:05 GMT</pubDate>` +
+				`<enclosure url="` + server.URL + `/media/` + n + `.mp3" type="audio/mpeg" length="10"/>` +
+				`</item>`)
+		}
+		body.WriteString(`<item><title>Trailer</title><guid>trailer</guid>` +
+			`<enclosure url="` + server.URL + `/media/trailer.mp4" type="video/mp4" length="10"/></item>`)
+		body.WriteString(`</channel></rss>`)
+		_, _ = w.Write([]byte(body.String()))
+	}))
+	t.Cleanup(server.Close)
+
+	options := FeedOptions{Enclosures: true, EnclosureTypes: []string{"audio/*"}, KeepEnclosures: 2, HTTP: defaultHTTPOptions()}
+	Config.Feeds = []Feed{{Name: "podcast", URL: server.URL, FeedOptions: options}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if _, err := UpdateFeed("podcast", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+
+	feedDir := filepath.Join(Config.FeedDirectory, "podcast")
+	for _, n := range items {
+		data, err := os.ReadFile(filepath.Join(feedDir, "Episode "+n+".mp3"))
+		if err != nil || string(data) != "media /media/"+n+".mp3" {
+			t.Fatalf("expected enclosure of episode %s, got %q (%v)", n, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(feedDir, "Trailer.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("expected video enclosure to be filtered out")
+	}
+
+	items = []string{"1", "2", "3"}
+	if _, err := UpdateFeed("podcast", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(feedDir, "Episode 3.mp3")); err != nil {
+		t.Fatalf("expected enclosure of the new episode: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(feedDir, "Episode 1.mp3")); !os.IsNotExist(err) {
+		t.Fatalf("expected only the last 2 episodes to be kept")
+	}
+	if _, err := os.Stat(filepath.Join(feedDir, "Episode 1")); err != nil {
+		t.Fatalf("expected the article of the oldest episode to be kept: %v", err)
+	}
+}
+
+func TestUpdateFeedsSpacesEnclosureDownloads(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	var mu sync.Mutex
+	var started []time.Time
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		started = append(started, time.Now())
+		mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/media/") {
+			_, _ = w.Write([]byte("media"))
+			return
+		}
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Podcast</title>` +
+			`<item><title>Episode 1</title><guid>1</guid><enclosure url="` + server.URL + `/media/1.mp3" type="audio/mpeg"/></item>` +
+			`<item><title>Episode 2</title><guid>2</guid><enclosure url="` + server.URL + `/media/2.mp3" type="audio/mpeg"/></item>` +
+			`</channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	const delay = 100 * time.Millisecond
+	Config.PerHostDelay = delay
+	Config.Feeds = []Feed{{Name: "podcast", URL: server.URL, FeedOptions: FeedOptions{Enclosures: true, HTTP: defaultHTTPOptions()}}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	UpdateFeeds([]string{"podcast"}, false)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(started) != 3 {
+		t.Fatalf("expected the feed and 2 enclosures to be requested, got %d requests", len(started))
+	}
+	for i := 1; i < len(started); i++ {
+		if gap := started[i].Sub(started[i-1]); gap < delay-10*time.Millisecond {
+			t.Errorf("expected requests to the feed's host to be spaced by %v, request %d followed after %v", delay, i, gap)
+		}
+	}
+}
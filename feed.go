@@ -3,8 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,15 +17,38 @@ import (
 )
 
 type Feed struct {
-	Name string
-	URL  string
+	Name      string
+	URL       string
+	Category  string
+	Directory string
+	Auth      AuthOptions
+	Scrape    *ScrapeOptions
+	FeedOptions
 }
 
 type FeedUpdateResult struct {
-	Name       string
-	Downloaded int
-	Skipped    int
-	Total      int
+	Name        string `json:"name"`
+	Downloaded  int    `json:"downloaded"`
+	Skipped     int    `json:"skipped"`
+	Filtered    int    `json:"filtered"`
+	Total       int    `json:"total"`
+	NotModified bool   `json:"not_modified"`
+	NotDue      bool   `json:"not_due"`
+	Error       string `json:"error,omitempty"`
+}
+
+// status describes the outcome of the update in a few words.
+func (r FeedUpdateResult) status() string {
+	switch {
+	case r.Error != "":
+		return "error: " + r.Error
+	case r.NotDue:
+		return "not due"
+	case r.NotModified:
+		return "not modified"
+	default:
+		return "ok"
+	}
 }
 
 const newArticleDirectory = "new"
@@ -73,11 +98,122 @@ func InitialiseNewArticleDirectory() error {
 	return os.MkdirAll(filepath.Join(Config.FeedDirectory, newArticleDirectory), 0o755)
 }
 
+// dir returns the directory the feed's articles are stored in.
+func (f Feed) dir() string {
+	if f.Directory != "" {
+		return f.Directory
+	}
+	return filepath.Join(Config.FeedDirectory, filepath.FromSlash(f.Category), f.Name)
+}
+
+// newLinkPath returns the path of the symlink to a newly downloaded article.
+func (f Feed) newLinkPath(name string) string {
+	return filepath.Join(Config.FeedDirectory, newArticleDirectory, filepath.FromSlash(f.Category), name)
+}
+
+// inCategory reports whether the feed belongs to category or one of its
+// subcategories.
+func (f Feed) inCategory(category string) bool {
+	return category != "" && (f.Category == category || strings.HasPrefix(f.Category, category+"/"))
+}
+
+// migrateLegacyDir moves the articles of a feed that was given a category
+// from the uncategorised location they were stored in before.
+func migrateLegacyDir(f Feed) {
+	if f.Directory != "" || f.Category == "" {
+		return
+	}
+	legacyDir := filepath.Join(Config.FeedDirectory, f.Name)
+	if _, err := os.Stat(f.dir()); !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if info, err := os.Stat(feedStatePath(legacyDir)); err != nil || info.IsDir() {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(f.dir()), 0o755); err != nil {
+		log.WithError(err).Warnf("Failed to create category directory for feed '%s'", f.Name)
+		return
+	}
+	if err := os.Rename(legacyDir, f.dir()); err != nil {
+		log.WithError(err).Warnf("Failed to move articles of feed '%s' into its category", f.Name)
+		return
+	}
+	log.Infof("Moved articles of feed '%s' from %s to %s", f.Name, legacyDir, f.dir())
+}
+
+// wants reports whether an item passes the feed's include and exclude
+// filters, which are matched against the item title.
+func (f Feed) wants(item *gofeed.Item) bool {
+	if f.Include != nil && !f.Include.MatchString(item.Title) {
+		return false
+	}
+	if f.Exclude != nil && f.Exclude.MatchString(item.Title) {
+		return false
+	}
+	return true
+}
+
 func DeleteFeedFiles(name string) error {
-	return os.RemoveAll(filepath.Join(Config.FeedDirectory, name))
+	feed, ok := Config.FeedByName(name)
+	if !ok {
+		return os.RemoveAll(filepath.Join(Config.FeedDirectory, name))
+	}
+	if feed.Directory != "" {
+		return deleteIndexedFiles(feed)
+	}
+	return os.RemoveAll(feed.dir())
+}
+
+// deleteIndexedFiles removes the articles and enclosures listed in the index
+// of a feed with an explicit directory, and the index itself. Since that
+// directory may hold other files, it is only removed if nothing else is
+// left in it.
+func deleteIndexedFiles(feed Feed) error {
+	dir := feed.dir()
+	state, err := loadFeedState(dir)
+	if err != nil {
+		return err
+	}
+
+	maildir := formatFor(feed).Maildir
+	for _, seen := range state.Items {
+		removeEnclosures(dir, seen)
+		if seen.File == "" {
+			continue
+		}
+		articlePath := filepath.Join(dir, seen.File)
+		if maildir {
+			if path, err := findMaildirMessage(dir, seen.File); err == nil {
+				articlePath = path
+			}
+		}
+		if err := os.Remove(articlePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		removeArticleAssets(articlePath)
+	}
+	if err := os.Remove(feedStatePath(dir)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if maildir {
+		for _, sub := range []string{maildirTmp, maildirNew, maildirCur} {
+			os.Remove(filepath.Join(dir, sub))
+		}
+	}
+	os.Remove(dir)
+	return nil
 }
 
 func UpdateFeed(name string, deleteFiles bool) (FeedUpdateResult, error) {
+	return updateFeed(name, deleteFiles, false, nil)
+}
+
+// updateFeed fetches a feed and stores its new articles. When
+// respectInterval is set, feeds fetched more recently than their configured
+// interval are left alone. The feed and every page fetched for its articles
+// are requested within a slot of hosts, if given.
+func updateFeed(name string, deleteFiles, respectInterval bool, hosts *hostLimiter) (FeedUpdateResult, error) {
 	result := FeedUpdateResult{Name: name}
 
 	feedConfig, ok := Config.FeedByName(name)
@@ -85,13 +221,52 @@ func UpdateFeed(name string, deleteFiles bool) (FeedUpdateResult, error) {
 		return result, fmt.Errorf("feed %q not found", name)
 	}
 
-	parser := gofeed.NewParser()
-	feed, err := parser.ParseURL(feedConfig.URL)
+	migrateLegacyDir(feedConfig)
+	feedDir := feedConfig.dir()
+
+	// A refetch starts from scratch, so no validators are sent and the
+	// full feed is always downloaded.
+	state := newFeedState()
+	if !deleteFiles {
+		loaded, err := loadFeedState(feedDir)
+		if err != nil {
+			return result, fmt.Errorf("load state for feed %q: %w", name, err)
+		}
+		state = loaded
+	}
+
+	if respectInterval && feedConfig.Interval > 0 && time.Since(state.LastFetch) < feedConfig.Interval {
+		result.NotDue = true
+		log.Debugf("Feed '%s' was fetched less than %v ago - skipping", name, feedConfig.Interval)
+		return result, nil
+	}
+
+	release := hosts.acquire(feedHost(feedConfig.URL))
+	feed, notModified, err := fetchFeed(feedConfig, state)
+	release()
 	if err != nil {
+		recordFetchError(feedDir, err)
 		return result, fmt.Errorf("fetch feed %q: %w", name, err)
 	}
+	state.LastFetch = time.Now()
+	state.LastError = ""
+	state.LastErrorAt = time.Time{}
+	if notModified {
+		result.NotModified = true
+		applyRetention(feedConfig, state, nil)
+		if feedConfig.Enclosures {
+			downloadEnclosures(feedConfig, feedDir, state, hosts)
+		}
+		if err := state.save(feedDir); err != nil {
+			return result, fmt.Errorf("save state for feed %q: %w", name, err)
+		}
+		log.Infof("Feed '%s' not modified since last update", name)
+		return result, nil
+	}
 
 	result.Total = len(feed.Items)
+	state.Title = feed.Title
+	state.SiteURL = feed.Link
 
 	if deleteFiles {
 		if err := DeleteFeedFiles(name); err != nil {
@@ -99,72 +274,144 @@ func UpdateFeed(name string, deleteFiles bool) (FeedUpdateResult, error) {
 		}
 	}
 
-	feedDir := filepath.Join(Config.FeedDirectory, name)
 	if err := os.MkdirAll(feedDir, 0o755); err != nil {
 		return result, fmt.Errorf("ensure feed directory for %q: %w", name, err)
 	}
 
+	format := formatFor(feedConfig)
+	claimed := state.claimedFiles()
+	inFeed := make(map[string]bool, len(feed.Items))
+	failed := 0
+
 	for _, item := range feed.Items {
-		articleName := truncateString(safeArticleName(item.Title), maxFileNameLength)
-		if articleName == "" {
-			log.WithField("feed", name).Warn("Skipping item with empty or invalid title")
+		key := itemKey(item)
+		inFeed[key] = true
+		if _, ok := state.Items[key]; ok {
+			log.Debugf("Article %s already seen in feed '%s' - skipping download", key, name)
 			result.Skipped++
 			continue
 		}
 
-		articlePath := filepath.Join(feedDir, articleName)
-		if _, err := os.Stat(articlePath); err == nil {
-			log.Debugf("Article %s already exists - skipping download", articlePath)
-			result.Skipped++
+		if !feedConfig.wants(item) {
+			log.Debugf("Article '%s' in feed '%s' excluded by filters", item.Title, name)
+			result.Filtered++
 			continue
-		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
-			log.WithError(err).Warnf("Unable to check if article exists: %s", articlePath)
+		}
+
+		seen := &seenItem{
+			Title:     item.Title,
+			Link:      item.Link,
+			Published: item.PublishedParsed,
+			Added:     time.Now(),
+		}
+
+		// Items already past the retention age are remembered without
+		// being stored, so they are not offered again on the next update.
+		if feedConfig.MaxAge > 0 && time.Since(seen.date()) > feedConfig.MaxAge {
+			state.Items[key] = seen
 			result.Skipped++
 			continue
 		}
 
-		file, err := os.Create(articlePath)
-		if err != nil {
-			log.WithError(err).Errorf("Failed to create file for article titled '%s'", item.Title)
+		if format.Maildir {
+			file, err := storeMaildirMessage(&article{Feed: feedConfig, Item: withFullText(feedConfig, item, hosts), Fetched: state.LastFetch, Hosts: hosts}, feedDir, format)
+			if err != nil {
+				log.WithError(err).Errorf("Failed to deliver article titled '%s'", item.Title)
+				failed++
+				result.Skipped++
+				continue
+			}
+			seen.File = file
+			if feedConfig.Enclosures {
+				base := truncateString(articleFileName(feedConfig, item), maxFileNameLength)
+				if base == "" {
+					base = "enclosure"
+				}
+				seen.Enclosures = planEnclosures(feedConfig, feedDir, item, base, claimed)
+			}
+			state.Items[key] = seen
+			result.Downloaded++
+			continue
+		}
+
+		articleName := truncateString(articleFileName(feedConfig, item), maxFileNameLength-len(format.Extension))
+		if articleName == "" {
+			log.WithField("feed", name).Warn("Skipping item with empty or invalid title")
 			result.Skipped++
 			continue
 		}
 
-		published := item.Published
-		if published == "" && item.PublishedParsed != nil {
-			published = item.PublishedParsed.Format(time.RFC3339)
+		// Articles stored before the index existed are adopted instead of
+		// being downloaded a second time.
+		articlePath := filepath.Join(feedDir, articleName+format.Extension)
+		if !claimed[articleName+format.Extension] {
+			if _, err := os.Stat(articlePath); err == nil {
+				seen.File = articleName + format.Extension
+				state.Items[key] = seen
+				claimed[seen.File] = true
+				log.Debugf("Article %s already exists - skipping download", articlePath)
+				result.Skipped++
+				continue
+			} else if !errors.Is(err, os.ErrNotExist) {
+				log.WithError(err).Warnf("Unable to check if article exists: %s", articlePath)
+				failed++
+				result.Skipped++
+				continue
+			}
 		}
 
-		var builder strings.Builder
-		builder.WriteString(item.Description)
-		builder.WriteByte('\n')
-		builder.WriteString(item.Link)
-		builder.WriteByte('\n')
-		builder.WriteString(published)
-		builder.WriteByte('\n')
-		builder.WriteString(item.Content)
+		articleName = uniqueArticleName(feedDir, articleName, format.Extension, claimed)
+		articlePath = filepath.Join(feedDir, articleName)
+
+		content, err := format.Render(&article{Feed: feedConfig, Item: withFullText(feedConfig, item, hosts), Path: articlePath, Fetched: state.LastFetch, Hosts: hosts})
+		if err != nil {
+			log.WithError(err).Errorf("Failed to render article titled '%s'", item.Title)
+			failed++
+			result.Skipped++
+			continue
+		}
 
-		if _, err := file.WriteString(builder.String()); err != nil {
+		if err := os.WriteFile(articlePath, content, 0o666); err != nil {
 			log.WithError(err).Errorf("Failed to write content for article titled '%s'", item.Title)
-			file.Close()
 			os.Remove(articlePath)
+			removeArticleAssets(articlePath)
+			failed++
 			result.Skipped++
 			continue
 		}
 
-		if err := file.Close(); err != nil {
-			log.WithError(err).Warnf("Failed to close file for article titled '%s'", item.Title)
+		date := itemDate(item)
+		if date != nil {
+			if err := os.Chtimes(articlePath, time.Now(), *date); err != nil {
+				log.WithError(err).Warnf("Failed to set modification time of %s", articlePath)
+			}
 		}
 
+		seen.File = articleName
+		claimed[articleName] = true
+		if feedConfig.Enclosures {
+			seen.Enclosures = planEnclosures(feedConfig, feedDir, item, strings.TrimSuffix(articleName, format.Extension), claimed)
+		}
+		state.Items[key] = seen
 		result.Downloaded++
 
-		newLinkPath := filepath.Join(Config.FeedDirectory, newArticleDirectory, articleName)
-		if err := os.Remove(newLinkPath); err != nil && !errors.Is(err, os.ErrNotExist) {
-			log.WithError(err).Warnf("Failed to remove existing symlink for article %s", newLinkPath)
-		}
-		if err := os.Symlink(articlePath, newLinkPath); err != nil {
-			log.WithError(err).Warnf("Could not create symlink for newly downloaded article %s", articlePath)
-		}
+		linkNewArticle(feedConfig, articleName, articlePath, date)
+	}
+
+	// Items that could not be stored are not in the index, so the feed must
+	// be downloaded in full next time for them to be retried.
+	if failed > 0 {
+		state.ETag = ""
+		state.LastModified = ""
+	}
+
+	applyRetention(feedConfig, state, inFeed)
+	if feedConfig.Enclosures {
+		downloadEnclosures(feedConfig, feedDir, state, hosts)
+	}
+
+	if err := state.save(feedDir); err != nil {
+		return result, fmt.Errorf("save state for feed %q: %w", name, err)
 	}
 
 	log.Infof("%d articles fetched from feed '%s' (%d already seen, %d total in feed)", result.Downloaded, name, result.Skipped, result.Total)
@@ -172,30 +419,199 @@ func UpdateFeed(name string, deleteFiles bool) (FeedUpdateResult, error) {
 	return result, nil
 }
 
-func UpdateAllFeeds(deleteFiles bool) []FeedUpdateResult {
-	results := make([]FeedUpdateResult, 0, len(Config.Feeds))
-	if len(Config.Feeds) == 0 {
+// recordFetchError stores a failed fetch in the feed's state, leaving the
+// rest of the state untouched.
+func recordFetchError(feedDir string, fetchErr error) {
+	state, err := loadFeedState(feedDir)
+	if err != nil {
+		log.WithError(err).Warnf("Failed to record fetch error in %s", feedDir)
+		return
+	}
+	state.LastError = fetchErr.Error()
+	state.LastErrorAt = time.Now()
+	if err := os.MkdirAll(feedDir, 0o755); err == nil {
+		err = state.save(feedDir)
+	}
+	if err != nil {
+		log.WithError(err).Warnf("Failed to record fetch error in %s", feedDir)
+	}
+}
+
+// applyRetention deletes the feed's articles that exceed its max_articles or
+// max_age limits. Deleted articles stay in the index so they are not
+// downloaded again, until they also drop out of the feed itself; with a nil
+// inFeed, as when the feed was not modified, the index is not pruned.
+func applyRetention(feedConfig Feed, state *feedState, inFeed map[string]bool) {
+	if inFeed != nil {
+		for key, seen := range state.Items {
+			if seen.File == "" && !inFeed[key] {
+				delete(state.Items, key)
+			}
+		}
+	}
+
+	if feedConfig.MaxArticles <= 0 && feedConfig.MaxAge <= 0 {
+		return
+	}
+	format := formatFor(feedConfig)
+
+	stored := make([]*seenItem, 0, len(state.Items))
+	for _, seen := range state.Items {
+		if seen.File != "" {
+			stored = append(stored, seen)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].date().After(stored[j].date())
+	})
+
+	for i, seen := range stored {
+		expired := feedConfig.MaxAge > 0 && time.Since(seen.date()) > feedConfig.MaxAge
+		overLimit := feedConfig.MaxArticles > 0 && i >= feedConfig.MaxArticles
+		if !expired && !overLimit {
+			continue
+		}
+
+		articlePath := filepath.Join(feedConfig.dir(), seen.File)
+		if format.Maildir {
+			if path, err := findMaildirMessage(feedConfig.dir(), seen.File); err == nil {
+				articlePath = path
+			}
+		}
+		if err := os.Remove(articlePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.WithError(err).Warnf("Failed to remove expired article %s", articlePath)
+			continue
+		}
+		removeArticleAssets(articlePath)
+		removeEnclosures(feedConfig.dir(), seen)
+		removeNewLink(feedConfig, seen.File, articlePath)
+		log.Debugf("Removed expired article %s", articlePath)
+		seen.File = ""
+	}
+}
+
+// itemDate returns when the item was published, or when it was last updated
+// if the feed does not give a publication date.
+func itemDate(item *gofeed.Item) *time.Time {
+	if item.PublishedParsed != nil {
+		return item.PublishedParsed
+	}
+	return item.UpdatedParsed
+}
+
+// linkNewArticle creates a symlink to a newly downloaded article in the new
+// article directory, grouped by the feed's category.
+func linkNewArticle(feedConfig Feed, name, articlePath string, date *time.Time) {
+	newLinkPath := feedConfig.newLinkPath(name)
+	if err := os.MkdirAll(filepath.Dir(newLinkPath), 0o755); err != nil {
+		log.WithError(err).Warnf("Could not create directory for symlink %s", newLinkPath)
+		return
+	}
+	if err := os.Remove(newLinkPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.WithError(err).Warnf("Failed to remove existing symlink for article %s", newLinkPath)
+	}
+	if err := os.Symlink(articlePath, newLinkPath); err != nil {
+		log.WithError(err).Warnf("Could not create symlink for newly downloaded article %s", articlePath)
+		return
+	}
+	if date != nil {
+		if err := setSymlinkTime(newLinkPath, *date); err != nil {
+			log.WithError(err).Debugf("Failed to set modification time of symlink %s", newLinkPath)
+		}
+	}
+}
+
+// retargetNewLinks points symlinks in the new article directory that lead
+// into oldDir at the same files under newDir, or removes them if newDir is
+// empty.
+func retargetNewLinks(oldDir, newDir string) {
+	root := filepath.Join(Config.FeedDirectory, newArticleDirectory)
+	prefix := oldDir + string(filepath.Separator)
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil || !strings.HasPrefix(target, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.WithError(err).Warnf("Failed to remove symlink %s", path)
+			return nil
+		}
+		if newDir == "" {
+			return nil
+		}
+		if err := os.Symlink(filepath.Join(newDir, strings.TrimPrefix(target, prefix)), path); err != nil {
+			log.WithError(err).Warnf("Failed to update symlink %s", path)
+			return nil
+		}
+		setSymlinkTime(path, info.ModTime())
+		return nil
+	})
+}
+
+// removeNewLink removes the symlink to articlePath from the new article
+// directory, if there is one.
+func removeNewLink(feedConfig Feed, name, articlePath string) {
+	newLinkPath := feedConfig.newLinkPath(name)
+	if target, err := os.Readlink(newLinkPath); err == nil && target == articlePath {
+		os.Remove(newLinkPath)
+	}
+}
+
+// UpdateFeeds updates the named feeds concurrently, honouring the configured
+// global and per-host concurrency limits. Results are returned in the order
+// of names.
+func UpdateFeeds(names []string, deleteFiles bool) []FeedUpdateResult {
+	return updateFeeds(names, deleteFiles, false)
+}
+
+func updateFeeds(names []string, deleteFiles, respectInterval bool) []FeedUpdateResult {
+	results := make([]FeedUpdateResult, len(names))
+	if len(names) == 0 {
 		return results
 	}
 
+	limit := Config.MaxConcurrency
+	if limit < 1 {
+		limit = defaultMaxConcurrency
+	}
+	sem := make(chan struct{}, limit)
+	hosts := newHostLimiter(Config.PerHostConcurrency, Config.PerHostDelay, sem)
+
 	var wg sync.WaitGroup
-	var mu sync.Mutex
+	for i, name := range names {
+		i, name := i, name
 
-	for _, feed := range Config.Feeds {
-		feedName := feed.Name
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			result, err := UpdateFeed(feedName, deleteFiles)
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result, err := updateFeed(name, deleteFiles, respectInterval, hosts)
 			if err != nil {
 				log.Error(err)
+				result.Error = err.Error()
 			}
-			mu.Lock()
-			results = append(results, result)
-			mu.Unlock()
+			results[i] = result
 		}()
 	}
 
 	wg.Wait()
 	return results
 }
+
+func UpdateAllFeeds(deleteFiles bool) []FeedUpdateResult {
+	names := make([]string, 0, len(Config.Feeds))
+	for _, feed := range Config.Feeds {
+		names = append(names, feed.Name)
+	}
+	return updateFeeds(names, deleteFiles, !deleteFiles)
+}
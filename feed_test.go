@@ -1,11 +1,18 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestTruncateString(t *testing.T) {
@@ -104,6 +111,56 @@ func TestUpdateFeedCreatesArticles(t *testing.T) {
 	}
 }
 
+func TestRefetchKeepsUnrelatedFilesInFeedDirectory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Notes</title><item><title>Article</title><guid>1</guid></item></channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	dir := filepath.Join(home, "notes")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	unrelated := filepath.Join(dir, "todo.txt")
+	if err := os.WriteFile(unrelated, []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	Config.Feeds = []Feed{{Name: "notes", URL: server.URL, FeedOptions: Config.Defaults, Directory: dir}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+
+	if _, err := UpdateFeed("notes", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Article"), []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := UpdateFeed("notes", true)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Downloaded != 1 {
+		t.Fatalf("expected the article to be fetched again, got %+v", result)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "Article")); err != nil || string(data) == "stale" {
+		t.Fatalf("expected the article to be replaced, got %q, %v", data, err)
+	}
+	if data, err := os.ReadFile(unrelated); err != nil || string(data) != "keep me" {
+		t.Fatalf("expected files not listed in the index to be kept, got %q, %v", data, err)
+	}
+}
+
 func TestUpdateFeedMissingFeed(t *testing.T) {
 	orig := Config
 	t.Cleanup(func() { Config = orig })
@@ -112,3 +169,592 @@ func TestUpdateFeedMissingFeed(t *testing.T) {
 		t.Fatalf("expected error when updating missing feed")
 	}
 }
+
+func TestUpdateFeedDedupesByGUID(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	body := `<rss version="2.0"><channel><title>Test Feed</title>` +
+		`<item><title>Same</title><guid>1</guid><description>first</description></item>` +
+		`<item><title>Same</title><guid>2</guid><description>second</description></item>` +
+		`</channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL}}
+
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+
+	result, err := UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Downloaded != 2 {
+		t.Fatalf("expected both items with colliding titles to be downloaded, got %d", result.Downloaded)
+	}
+
+	feedDir := filepath.Join(Config.FeedDirectory, "test-feed")
+	for _, name := range []string{"Same", "Same (2)"} {
+		if _, err := os.Stat(filepath.Join(feedDir, name)); err != nil {
+			t.Fatalf("expected article %q to exist: %v", name, err)
+		}
+	}
+
+	body = `<rss version="2.0"><channel><title>Test Feed</title>` +
+		`<item><title>Same (edited)</title><guid>1</guid><description>first</description></item>` +
+		`<item><title>Same</title><guid>2</guid><description>second</description></item>` +
+		`</channel></rss>`
+
+	result, err = UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Downloaded != 0 || result.Skipped != 2 {
+		t.Fatalf("expected retitled item to be recognised as seen, got %+v", result)
+	}
+}
+
+func TestUpdateFeedAdoptsExistingArticles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	body := `<rss version="2.0"><channel><title>Test Feed</title><item><title>Old</title><guid>1</guid></item></channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL}}
+
+	feedDir := filepath.Join(Config.FeedDirectory, "test-feed")
+	if err := os.MkdirAll(feedDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(feedDir, "Old"), []byte("legacy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Downloaded != 0 || result.Skipped != 1 {
+		t.Fatalf("expected legacy article to be adopted, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(feedDir, "Old (2)")); !os.IsNotExist(err) {
+		t.Fatalf("expected no duplicate article to be written")
+	}
+}
+
+func TestUpdateFeedConditionalFetch(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	const etag = `"v1"`
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	body := `<rss version="2.0"><channel><title>Test Feed</title><item><title>One</title><guid>1</guid></item></channel></rss>`
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL}}
+
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+
+	result, err := UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.NotModified || result.Downloaded != 1 {
+		t.Fatalf("expected first fetch to download the feed, got %+v", result)
+	}
+
+	result, err = UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if !result.NotModified {
+		t.Fatalf("expected second fetch to be reported as not modified, got %+v", result)
+	}
+
+	result, err = UpdateFeed("test-feed", true)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.NotModified || result.Downloaded != 1 {
+		t.Fatalf("expected refetch to ignore stored validators, got %+v", result)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestUpdateFeedRetriesItemsThatFailedToStore(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	const etag = `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title><item><title>One</title><guid>1</guid></item></channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	feed := Feed{Name: "test-feed", URL: server.URL, FeedOptions: Config.Defaults}
+	feed.Format = "maildir"
+	Config.Feeds = []Feed{feed}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+
+	// A file in place of the cur/ folder makes every delivery fail.
+	blocker := filepath.Join(feed.dir(), maildirCur)
+	if err := os.MkdirAll(feed.dir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Downloaded != 0 {
+		t.Fatalf("expected delivery to fail, got %+v", result)
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	result, err = UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.NotModified || result.Downloaded != 1 {
+		t.Fatalf("expected the item that failed to be retried, got %+v", result)
+	}
+
+	result, err = UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if !result.NotModified {
+		t.Fatalf("expected validators to be kept once every item is stored, got %+v", result)
+	}
+}
+
+func TestUpdateFeedFiltersAndRetention(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	body := `<rss version="2.0"><channel><title>Test Feed</title>` +
+		`<item><title>Release 3</title><guid>3</guid><pubDate>Wed, 03 Jan 2024 00:00:00 GMT</pubDate></item>` +
+		`<item><title>Release 2</title><guid>2</guid><pubDate>Tue, 02 Jan 2024 00:00:00 GMT</pubDate></item>` +
+		`<item><title>Sponsored Release</title><guid>s</guid><pubDate>Tue, 02 Jan 2024 00:00:00 GMT</pubDate></item>` +
+		`<item><title>Release 1</title><guid>1</guid><pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate></item>` +
+		`</channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	feed := Feed{Name: "test-feed", URL: server.URL, Directory: filepath.Join(home, "custom")}
+	feed.Exclude = regexp.MustCompile("Sponsored")
+	feed.MaxArticles = 2
+	Config.Feeds = []Feed{feed}
+
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+
+	result, err := UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Downloaded != 3 || result.Filtered != 1 {
+		t.Fatalf("expected 3 downloaded and 1 filtered article, got %+v", result)
+	}
+
+	for name, want := range map[string]bool{"Release 3": true, "Release 2": true, "Release 1": false, "Sponsored Release": false} {
+		_, err := os.Stat(filepath.Join(home, "custom", name))
+		if exists := err == nil; exists != want {
+			t.Errorf("expected %q to exist: %v, got %v", name, want, exists)
+		}
+	}
+
+	result, err = UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Downloaded != 0 {
+		t.Fatalf("expected removed article not to be downloaded again, got %+v", result)
+	}
+}
+
+func TestUpdateFeedAppliesRetentionWhenNotModified(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	const etag = `"v1"`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title>` +
+			`<item><title>Old</title><guid>1</guid><pubDate>Mon, 01 Jan 2024 00:00:00 GMT</pubDate></item>` +
+			`</channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if _, err := UpdateFeed("test-feed", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	articlePath := filepath.Join(Config.FeedDirectory, "test-feed", "Old")
+	if _, err := os.Stat(articlePath); err != nil {
+		t.Fatalf("expected article to be stored: %v", err)
+	}
+
+	Config.Feeds[0].MaxAge = 30 * 24 * time.Hour
+	result, err := UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if !result.NotModified {
+		t.Fatalf("expected feed to be reported as not modified, got %+v", result)
+	}
+	if _, err := os.Stat(articlePath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected expired article to be removed, got %v", err)
+	}
+
+	state, err := loadFeedState(Config.Feeds[0].dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Items) != 1 {
+		t.Fatalf("expected the index to keep the expired item, got %+v", state.Items)
+	}
+}
+
+func TestUpdateAllFeedsRespectsInterval(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title></channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	feed := Feed{Name: "test-feed", URL: server.URL}
+	feed.Interval = time.Hour
+	Config.Feeds = []Feed{feed}
+
+	UpdateAllFeeds(false)
+	results := UpdateAllFeeds(false)
+	if len(results) != 1 || !results[0].NotDue {
+		t.Fatalf("expected second update to be skipped as not due, got %+v", results)
+	}
+	if requests != 1 {
+		t.Fatalf("expected a single request, got %d", requests)
+	}
+
+	if _, err := UpdateFeed("test-feed", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("expected explicitly named feed to be fetched regardless of interval, got %d requests", requests)
+	}
+}
+
+func TestUpdateAllFeedsSkipsHostDelayWhenNotDue(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title></channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	for _, name := range []string{"first", "second", "third"} {
+		feed := Feed{Name: name, URL: server.URL + "/" + name}
+		feed.Interval = time.Hour
+		Config.Feeds = append(Config.Feeds, feed)
+	}
+	UpdateAllFeeds(false)
+
+	const delay = 500 * time.Millisecond
+	Config.PerHostDelay = delay
+	start := time.Now()
+	for _, result := range UpdateAllFeeds(false) {
+		if !result.NotDue {
+			t.Fatalf("expected feeds not to be due, got %+v", result)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Fatalf("expected feeds that are not due to skip the per-host delay, took %v", elapsed)
+	}
+}
+
+func TestUpdateFeedsDoesNotDelayOtherHosts(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	var mu sync.Mutex
+	started := map[string]time.Time{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		started[r.URL.Path] = time.Now()
+		mu.Unlock()
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title></channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	// The same server is reached as two hosts, so that only the busy one is
+	// limited by the delay.
+	busy := server.URL
+	idle := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	var names []string
+	for i := 0; i < 12; i++ {
+		names = append(names, "busy-"+strconv.Itoa(i))
+		Config.Feeds = append(Config.Feeds, Feed{Name: names[len(names)-1], URL: busy + "/busy/" + strconv.Itoa(i)})
+	}
+	for i := 0; i < 4; i++ {
+		names = append(names, "idle-"+strconv.Itoa(i))
+		Config.Feeds = append(Config.Feeds, Feed{Name: names[len(names)-1], URL: idle + "/idle/" + strconv.Itoa(i)})
+	}
+	Config.MaxConcurrency = 4
+	Config.PerHostConcurrency = 1
+	Config.PerHostDelay = 200 * time.Millisecond
+
+	start := time.Now()
+	for _, result := range UpdateFeeds(names, false) {
+		if result.Error != "" {
+			t.Fatalf("unexpected error: %+v", result)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < 4; i++ {
+		at, ok := started["/idle/"+strconv.Itoa(i)]
+		if !ok {
+			t.Fatalf("expected feed idle-%d to be fetched", i)
+		}
+		// The idle host only spaces its own four requests.
+		if elapsed := at.Sub(start); elapsed > 4*Config.PerHostDelay {
+			t.Errorf("expected feed idle-%d not to wait for the busy host, started after %v", i, elapsed)
+		}
+	}
+}
+
+func TestUpdateFeedStoresByCategory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title><item><title>Post</title><guid>1</guid></item></channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if _, err := UpdateFeed("test-feed", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+
+	Config.Feeds[0].Category = "Tech/Go"
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	result, err := UpdateFeed("test-feed", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Downloaded != 0 {
+		t.Fatalf("expected existing articles to move with the feed, got %+v", result)
+	}
+
+	articlePath := filepath.Join(Config.FeedDirectory, "Tech", "Go", "test-feed", "Post")
+	if _, err := os.Stat(articlePath); err != nil {
+		t.Fatalf("expected article in category directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(Config.FeedDirectory, "test-feed")); !os.IsNotExist(err) {
+		t.Fatalf("expected uncategorised directory to be moved")
+	}
+
+	Config.Feeds = append(Config.Feeds, Feed{Name: "other-feed", URL: server.URL, Category: "Tech"})
+	if _, err := UpdateFeed("other-feed", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	newLink := filepath.Join(Config.FeedDirectory, newArticleDirectory, "Tech", "Post")
+	if target, err := os.Readlink(newLink); err != nil || target != filepath.Join(Config.FeedDirectory, "Tech", "other-feed", "Post") {
+		t.Fatalf("expected new symlink grouped by category, got %q (%v)", target, err)
+	}
+}
+
+func TestUpdateFeedWritesMarkdown(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title>` +
+			`<item><title>Post</title><guid>1</guid><description>&lt;p&gt;first&lt;/p&gt;</description></item>` +
+			`<item><title>Post</title><guid>2</guid><description>second</description></item>` +
+			`</channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL, FeedOptions: FeedOptions{Format: "markdown"}}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if _, err := UpdateFeed("test-feed", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+
+	feedDir := filepath.Join(Config.FeedDirectory, "test-feed")
+	for _, name := range []string{"Post.md", "Post (2).md"} {
+		if _, err := os.Stat(filepath.Join(feedDir, name)); err != nil {
+			t.Fatalf("expected article %q to exist: %v", name, err)
+		}
+		if _, err := os.Readlink(filepath.Join(Config.FeedDirectory, newArticleDirectory, name)); err != nil {
+			t.Fatalf("expected new symlink %q: %v", name, err)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(feedDir, "Post.md"))
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	if !regexp.MustCompile(`(?s)^---\ntitle: "Post"\n.*---\n\nfirst\n$`).Match(content) {
+		t.Fatalf("unexpected Markdown article:\n%s", content)
+	}
+}
+
+func TestUpdateFeedUsesPublishDate(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title>` +
+			`<item><title>Post</title><guid>1</guid><pubDate>Mon, 02 Jan 2006 12:00:00 GMT</pubDate></item>` +
+			`</channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL, FeedOptions: FeedOptions{DatePrefix: true}}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if _, err := UpdateFeed("test-feed", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+
+	published := time.Date(2006, 1, 2, 12, 0, 0, 0, time.UTC)
+	name := published.Local().Format("2006-01-02") + " Post"
+
+	info, err := os.Stat(filepath.Join(Config.FeedDirectory, "test-feed", name))
+	if err != nil {
+		t.Fatalf("expected date-prefixed article: %v", err)
+	}
+	if !info.ModTime().Equal(published) {
+		t.Fatalf("expected article mtime %v, got %v", published, info.ModTime())
+	}
+
+	info, err = os.Lstat(filepath.Join(Config.FeedDirectory, newArticleDirectory, name))
+	if err != nil {
+		t.Fatalf("expected new symlink: %v", err)
+	}
+	if runtime.GOOS != "windows" && !info.ModTime().Equal(published) {
+		t.Fatalf("expected symlink mtime %v, got %v", published, info.ModTime())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// fetchFeed downloads and parses the feed using its HTTP and authentication
+// options. When the state carries validators from a previous fetch they are
+// sent along, and a 304 response is reported as notModified with a nil feed.
+// On success the state's validators are replaced with the ones from the
+// response.
+func fetchFeed(feedConfig Feed, state *feedState) (feed *gofeed.Feed, notModified bool, err error) {
+	client, err := httpClientFor(feedConfig.HTTP)
+	if err != nil {
+		return nil, false, err
+	}
+
+	req, err := newFeedRequest(feedConfig)
+	if err != nil {
+		return nil, false, err
+	}
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		req.Header.Set("If-Modified-Since", state.LastModified)
+	}
+
+	resp, err := doWithRetry(client, req, feedConfig.HTTP)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, true, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, false, gofeed.HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	feed, err = parseFeedResponse(feedConfig, resp)
+	if err != nil {
+		return nil, false, err
+	}
+
+	state.ETag = resp.Header.Get("ETag")
+	state.LastModified = resp.Header.Get("Last-Modified")
+
+	return feed, false, nil
+}
+
+// newFeedRequest returns a request for the feed's URL carrying its
+// credentials.
+func newFeedRequest(feedConfig Feed) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, feedConfig.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := feedConfig.Auth.apply(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// authorize adds the feed's credentials to req, which may be for any page
+// or file the feed refers to. Credentials are only sent to the host serving
+// the feed.
+func (f Feed) authorize(req *http.Request) error {
+	if strings.ToLower(req.URL.Hostname()) != feedHost(f.URL) {
+		return nil
+	}
+	return f.Auth.apply(req)
+}
+
+// parseFeedResponse parses the body of a successful response for the feed.
+// Scrape feeds are built from the fetched page with their selectors instead
+// of being parsed as a feed.
+func parseFeedResponse(feedConfig Feed, resp *http.Response) (*gofeed.Feed, error) {
+	if feedConfig.Scrape != nil {
+		return scrapePage(resp.Body, resp.Request.URL, feedConfig.Scrape)
+	}
+	return gofeed.NewParser().Parse(resp.Body)
+}
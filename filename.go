@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const defaultFilenameTemplate = "{title}"
+
+var filenamePlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// filenameFields expand the placeholders of a filename template for an item
+// of a feed.
+var filenameFields = map[string]func(feed Feed, item *gofeed.Item) string{
+	"title": func(feed Feed, item *gofeed.Item) string { return item.Title },
+	"slug":  func(feed Feed, item *gofeed.Item) string { return slugify(item.Title) },
+	"date":  func(feed Feed, item *gofeed.Item) string { return filenameDate(item).Format("2006-01-02") },
+	"time":  func(feed Feed, item *gofeed.Item) string { return filenameDate(item).Format("15-04-05") },
+	"feed":  func(feed Feed, item *gofeed.Item) string { return feed.Name },
+	"author": func(feed Feed, item *gofeed.Item) string {
+		person := item.Author
+		if len(item.Authors) > 0 {
+			person = item.Authors[0]
+		}
+		switch {
+		case person == nil:
+			return ""
+		case person.Name != "":
+			return person.Name
+		}
+		return person.Email
+	},
+	"hash": func(feed Feed, item *gofeed.Item) string {
+		sum := sha256.Sum256([]byte(itemKey(item)))
+		return hex.EncodeToString(sum[:])[:12]
+	},
+}
+
+// validateFilenameTemplate checks that template only uses known
+// placeholders.
+func validateFilenameTemplate(template string) error {
+	rest := template
+	for _, match := range filenamePlaceholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := filenameFields[match[1]]; !ok {
+			return fmt.Errorf("invalid filename_template %q: unknown placeholder %s", template, match[0])
+		}
+		rest = strings.Replace(rest, match[0], "", 1)
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("invalid filename_template %q: unbalanced braces", template)
+	}
+	return nil
+}
+
+// articleFileName returns the name of the file an item is stored in,
+// without the extension of the feed's format, by expanding its filename
+// template. The result is made safe with safeArticleName; it is empty if
+// nothing usable is left.
+func articleFileName(feed Feed, item *gofeed.Item) string {
+	template := feed.FilenameTemplate
+	if template == "" {
+		template = defaultFilenameTemplate
+	}
+	if feed.DatePrefix {
+		template = "{date} " + template
+	}
+
+	name := filenamePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		field := filenameFields[strings.Trim(placeholder, "{}")]
+		if field == nil {
+			return placeholder
+		}
+		return strings.TrimSpace(safeArticleName(field(feed, item)))
+	})
+
+	// A leading dot would hide the file and could clash with the feed's
+	// state file.
+	return strings.TrimSpace(strings.TrimLeft(safeArticleName(name), ". "))
+}
+
+// filenameDate returns the item's date in local time, falling back to the
+// current time if the feed gives none.
+func filenameDate(item *gofeed.Item) time.Time {
+	if date := itemDate(item); date != nil {
+		return date.Local()
+	}
+	return time.Now()
+}
+
+// slugify turns s into lower-case words joined by hyphens.
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
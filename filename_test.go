@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestArticleFileName(t *testing.T) {
+	published := time.Date(2006, 1, 2, 12, 4, 5, 0, time.Local)
+	item := &gofeed.Item{
+		Title:           "Hello, World: Part 1/2?",
+		GUID:            "guid-1",
+		PublishedParsed: &published,
+		Authors:         []*gofeed.Person{{Name: "Jane Doe", Email: "jane@example.com"}},
+	}
+	feed := Feed{Name: "test-feed"}
+
+	tests := []struct {
+		template   string
+		datePrefix bool
+		want       string
+	}{
+		{"", false, "Hello, World Part 12"},
+		{"", true, "2006-01-02 Hello, World Part 12"},
+		{"{date}_{time} {slug}", false, "2006-01-02_12-04-05 hello-world-part-1-2"},
+		{"{feed} - {author} - {hash}", false, "test-feed - Jane Doe - ee24931349a0"},
+		{"{title} (draft)", true, "2006-01-02 Hello, World Part 12 (draft)"},
+		{"..{slug}", false, "hello-world-part-1-2"},
+	}
+
+	for _, tc := range tests {
+		feed.FilenameTemplate, feed.DatePrefix = tc.template, tc.datePrefix
+		if got := articleFileName(feed, item); got != tc.want {
+			t.Errorf("articleFileName(%q, %v) = %q, want %q", tc.template, tc.datePrefix, got, tc.want)
+		}
+	}
+
+	feed.FilenameTemplate, feed.DatePrefix = "", false
+	if got := articleFileName(feed, &gofeed.Item{Title: " ?/ "}); got != "" {
+		t.Errorf("expected empty name for unusable title, got %q", got)
+	}
+}
+
+func TestValidateFilenameTemplate(t *testing.T) {
+	for _, template := range []string{"{title}", "{date} {slug}-{hash}", "plain"} {
+		if err := validateFilenameTemplate(template); err != nil {
+			t.Errorf("validateFilenameTemplate(%q) returned error: %v", template, err)
+		}
+	}
+	for _, template := range []string{"{nope}", "{title", "title}", "{Title}"} {
+		if err := validateFilenameTemplate(template); err == nil {
+			t.Errorf("expected validateFilenameTemplate(%q) to fail", template)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Hello, World!":   "hello-world",
+		"  Go 1.22 —  ok": "go-1-22-ok",
+		"Ünïcode Straße":  "ünïcode-straße",
+		"?!":              "",
+	}
+	for input, want := range tests {
+		if got := slugify(input); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const defaultFormat = "raw"
+
+// article is a single feed item fetched at Fetched and about to be written
+// to disk at Path. Any images it needs are downloaded within a slot of
+// Hosts, if given.
+type article struct {
+	Feed    Feed
+	Item    *gofeed.Item
+	Path    string
+	Fetched time.Time
+	Hosts   *hostLimiter
+}
+
+// articleFormat describes how articles are rendered into files. Articles
+// in a Maildir format are delivered as messages into the feed directory
+// instead of being named after their title.
+type articleFormat struct {
+	Extension string
+	Render    func(a *article) ([]byte, error)
+	Maildir   bool
+}
+
+var articleFormats = map[string]articleFormat{
+	"raw":      {Render: renderRaw},
+	"markdown": {Extension: ".md", Render: renderMarkdown},
+	"text":     {Extension: ".txt", Render: renderText},
+	"html":     {Extension: ".html", Render: renderHTML},
+	"maildir":  {Render: renderMail, Maildir: true},
+	"json":     {Extension: ".json", Render: renderJSON},
+}
+
+// formatFor returns the format used to store the feed's articles.
+func formatFor(feed Feed) articleFormat {
+	if format, ok := articleFormats[feed.Format]; ok {
+		return format
+	}
+	return articleFormats[defaultFormat]
+}
+
+// renderRaw writes the item's description, link, publication date and
+// content on consecutive lines, exactly as received from the feed.
+func renderRaw(a *article) ([]byte, error) {
+	item := a.Item
+
+	published := item.Published
+	if published == "" && item.PublishedParsed != nil {
+		published = item.PublishedParsed.Format(time.RFC3339)
+	}
+
+	var builder strings.Builder
+	builder.WriteString(item.Description)
+	builder.WriteByte('\n')
+	builder.WriteString(item.Link)
+	builder.WriteByte('\n')
+	builder.WriteString(published)
+	builder.WriteByte('\n')
+	builder.WriteString(item.Content)
+
+	return []byte(builder.String()), nil
+}
+
+// jsonArticle is the document written for an article in the json format.
+type jsonArticle struct {
+	Feed     string       `json:"feed"`
+	Category string       `json:"category,omitempty"`
+	Fetched  time.Time    `json:"fetched"`
+	Key      string       `json:"key"`
+	Hash     string       `json:"hash"`
+	Item     *gofeed.Item `json:"item"`
+}
+
+// renderJSON writes the complete item as parsed from the feed, along with
+// the feed it came from, when it was fetched, its key in the feed's index
+// and a hash of its title, description and content.
+func renderJSON(a *article) ([]byte, error) {
+	data, err := json.MarshalIndent(jsonArticle{
+		Feed:     a.Feed.Name,
+		Category: a.Feed.Category,
+		Fetched:  a.Fetched,
+		Key:      itemKey(a.Item),
+		Hash:     itemHash(a.Item),
+		Item:     a.Item,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestRenderJSON(t *testing.T) {
+	fetched := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	item := &gofeed.Item{
+		Title:      "Title",
+		Content:    "<p>Body</p>",
+		GUID:       "guid-1",
+		Author:     &gofeed.Person{Name: "Jane"},
+		Categories: []string{"go"},
+		Enclosures: []*gofeed.Enclosure{{URL: "https://example.com/a.mp3", Type: "audio/mpeg", Length: "123"}},
+		Image:      &gofeed.Image{URL: "https://example.com/a.png"},
+	}
+
+	content, err := renderJSON(&article{Feed: Feed{Name: "test-feed", Category: "Tech"}, Item: item, Fetched: fetched})
+	if err != nil {
+		t.Fatalf("renderJSON returned error: %v", err)
+	}
+
+	var doc struct {
+		Feed     string       `json:"feed"`
+		Category string       `json:"category"`
+		Fetched  time.Time    `json:"fetched"`
+		Key      string       `json:"key"`
+		Hash     string       `json:"hash"`
+		Item     *gofeed.Item `json:"item"`
+	}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatalf("expected valid JSON: %v\n%s", err, content)
+	}
+	if doc.Feed != "test-feed" || doc.Category != "Tech" || !doc.Fetched.Equal(fetched) || doc.Key != "guid:guid-1" || doc.Hash != itemHash(item) {
+		t.Fatalf("unexpected metadata: %+v", doc)
+	}
+	if doc.Item == nil || doc.Item.Author.Name != "Jane" || doc.Item.Categories[0] != "go" ||
+		doc.Item.Enclosures[0].URL != "https://example.com/a.mp3" || doc.Item.Image.URL != "https://example.com/a.png" {
+		t.Fatalf("expected the complete item, got %+v", doc.Item)
+	}
+}
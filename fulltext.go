@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxPageSize limits the size of a page fetched for full-text extraction.
+	maxPageSize = 5 << 20
+
+	// minFullTextLength is the number of characters extracted content must
+	// have to be used instead of the feed's content.
+	minFullTextLength = 250
+)
+
+var (
+	unlikelyCandidate = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|menu|modal|nav|popup|promo|related|remark|rss|share|shoutbox|sidebar|social|sponsor|subscribe|tags|tool|widget|\bad-|advert`)
+	maybeCandidate    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveWeight    = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeWeight    = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// withFullText returns item with its content replaced by the article
+// extracted from the page it links to, if the feed has fulltext enabled.
+// The item is returned unchanged if the page cannot be fetched or no
+// article is found in it. The page is fetched within a slot of hosts, if
+// given.
+func withFullText(feed Feed, item *gofeed.Item, hosts *hostLimiter) *gofeed.Item {
+	if !feed.FullText || strings.TrimSpace(item.Link) == "" {
+		return item
+	}
+
+	content, err := fetchFullText(feed, item.Link, hosts)
+	if err != nil {
+		log.WithError(err).Warnf("Failed to extract full text of %s - using feed content", item.Link)
+		return item
+	}
+
+	full := *item
+	full.Content = content
+	return &full
+}
+
+func fetchFullText(feed Feed, link string, hosts *hostLimiter) (string, error) {
+	client, err := httpClientFor(feed.HTTP)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := feed.authorize(req); err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+	release := hosts.acquire(feedHost(link))
+	defer release()
+	resp, err := doWithRetry(client, req, feed.HTTP)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return "", fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return "", fmt.Errorf("parse page: %w", err)
+	}
+	return extractArticle(doc)
+}
+
+// extractArticle finds the main content of a page the way readability
+// does: paragraphs are scored by their length and number of commas, their
+// scores are added to their parent and grandparent, and the best scoring
+// element, adjusted for class names and link density, is taken along with
+// related siblings.
+func extractArticle(doc *goquery.Document) (string, error) {
+	doc.Find("script, style, noscript, iframe, form, object, embed, nav, aside, footer, header, button, input, select, textarea, link, meta").Remove()
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		if goquery.NodeName(s) == "body" || goquery.NodeName(s) == "html" || goquery.NodeName(s) == "article" {
+			return
+		}
+		match := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if unlikelyCandidate.MatchString(match) && !maybeCandidate.MatchString(match) {
+			s.Remove()
+		}
+	})
+
+	scores := map[*html.Node]float64{}
+	var candidates []*goquery.Selection
+	addScore := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 {
+			return
+		}
+		node := s.Get(0)
+		if _, ok := scores[node]; !ok {
+			scores[node] = initialScore(s)
+			candidates = append(candidates, s)
+		}
+		scores[node] += score
+	}
+
+	doc.Find("p, pre, td").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		addScore(s.Parent(), score)
+		addScore(s.Parent().Parent(), score/2)
+	})
+
+	var top *goquery.Selection
+	topScore := 0.0
+	for _, candidate := range candidates {
+		node := candidate.Get(0)
+		scores[node] *= 1 - linkDensity(candidate)
+		if top == nil || scores[node] > topScore {
+			top, topScore = candidate, scores[node]
+		}
+	}
+	if top == nil {
+		return "", fmt.Errorf("no article content found")
+	}
+
+	// Siblings that scored well or look like paragraphs of the same text
+	// belong to the article too.
+	threshold := math.Max(10, topScore*0.2)
+	var parts []string
+	top.Parent().Children().Each(func(_ int, sibling *goquery.Selection) {
+		node := sibling.Get(0)
+		keep := node == top.Get(0)
+		if score, ok := scores[node]; ok && score >= threshold {
+			keep = true
+		}
+		if goquery.NodeName(sibling) == "p" {
+			text := strings.TrimSpace(sibling.Text())
+			density := linkDensity(sibling)
+			if len(text) > 80 && density < 0.25 || len(text) > 0 && len(text) <= 80 && density == 0 && strings.Contains(text, ". ") {
+				keep = true
+			}
+		}
+		if !keep {
+			return
+		}
+		if content, err := goquery.OuterHtml(sibling); err == nil {
+			parts = append(parts, content)
+		}
+	})
+
+	content := strings.Join(parts, "\n")
+	if text := strings.Join(strings.Fields(top.Parent().Text()), " "); len(text) < minFullTextLength || len(content) == 0 {
+		return "", fmt.Errorf("no article content found")
+	}
+	return content, nil
+}
+
+// initialScore rates an element by its tag and by its class name and ID.
+func initialScore(s *goquery.Selection) float64 {
+	score := 0.0
+	switch goquery.NodeName(s) {
+	case "article":
+		score += 10
+	case "div", "section", "main":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	for _, attr := range []string{"class", "id"} {
+		value := s.AttrOr(attr, "")
+		if value == "" {
+			continue
+		}
+		if negativeWeight.MatchString(value) {
+			score -= 25
+		}
+		if positiveWeight.MatchString(value) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// linkDensity returns the share of an element's text that is link text.
+func linkDensity(s *goquery.Selection) float64 {
+	length := len(strings.TrimSpace(s.Text()))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linkLength += len(strings.TrimSpace(a.Text()))
+	})
+	return float64(linkLength) / float64(length)
+}
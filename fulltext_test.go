@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const articlePage = `<!DOCTYPE html>
+<html><head><title>Post</title><script>track()</script></head>
+<body>
+<div id="nav"><a href="/">Home</a> <a href="/about">About</a> <a href="/archive">Archive</a></div>
+<div class="layout">
+  <div class="post-content">
+    <h1>A long post</h1>
+    <p>The first paragraph of the article, which goes on for a while, so that it is clearly part of the text.</p>
+    <p>The second paragraph continues the story, adding detail, commas, and more words than any menu would have.</p>
+    <p>The third paragraph wraps it all up, with a <a href="/more">link</a> in the middle of ordinary prose.</p>
+  </div>
+  <div class="sidebar">
+    <p>Subscribe to the newsletter for more posts like this one, delivered every week to your inbox.</p>
+  </div>
+  <div class="comments">
+    <p>Great post, thanks for writing it, I learned a lot from reading this article today.</p>
+  </div>
+</div>
+<footer>Copyright</footer>
+</body></html>`
+
+func TestExtractArticle(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(articlePage))
+	if err != nil {
+		t.Fatalf("parse page: %v", err)
+	}
+
+	content, err := extractArticle(doc)
+	if err != nil {
+		t.Fatalf("extractArticle returned error: %v", err)
+	}
+	for _, want := range []string{"first paragraph", "second paragraph", "third paragraph", `<a href="/more">`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected extracted content to contain %q, got:\n%s", want, content)
+		}
+	}
+	for _, unwanted := range []string{"Archive", "newsletter", "Great post", "Copyright", "track()"} {
+		if strings.Contains(content, unwanted) {
+			t.Errorf("expected extracted content not to contain %q, got:\n%s", unwanted, content)
+		}
+	}
+}
+
+func TestExtractArticleWithoutContent(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body><p>Too short to be an article.</p></body></html>`))
+	if err != nil {
+		t.Fatalf("parse page: %v", err)
+	}
+	if _, err := extractArticle(doc); err == nil {
+		t.Fatal("expected an error for a page without article content")
+	}
+}
+
+func TestUpdateFeedFullText(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title>` +
+				`<item><title>Full</title><guid>1</guid><link>` + server.URL + `/post</link><description>Teaser only</description></item>` +
+				`<item><title>Missing</title><guid>2</guid><link>` + server.URL + `/missing</link><description>Teaser kept</description></item>` +
+				`</channel></rss>`))
+		case "/post":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(articlePage))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL + "/feed", FeedOptions: FeedOptions{Format: "markdown", FullText: true}}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if _, err := UpdateFeed("test-feed", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+
+	full, err := os.ReadFile(filepath.Join(Config.FeedDirectory, "test-feed", "Full.md"))
+	if err != nil {
+		t.Fatalf("read article: %v", err)
+	}
+	if !strings.Contains(string(full), "second paragraph") || strings.Contains(string(full), "Teaser only") {
+		t.Fatalf("expected extracted article text, got:\n%s", full)
+	}
+
+	missing, err := os.ReadFile(filepath.Join(Config.FeedDirectory, "test-feed", "Missing.md"))
+	if err != nil {
+		t.Fatalf("read article: %v", err)
+	}
+	if !strings.Contains(string(missing), "Teaser kept") {
+		t.Fatalf("expected feed content as fallback, got:\n%s", missing)
+	}
+}
+
+func TestUpdateFeedsSpacesFullTextRequests(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	var mu sync.Mutex
+	var started []time.Time
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		started = append(started, time.Now())
+		mu.Unlock()
+		if r.URL.Path == "/feed" {
+			_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title>` +
+				`<item><title>One</title><guid>1</guid><link>` + server.URL + `/one</link></item>` +
+				`<item><title>Two</title><guid>2</guid><link>` + server.URL + `/two</link></item>` +
+				`<item><title>Three</title><guid>3</guid><link>` + server.URL + `/three</link></item>` +
+				`</channel></rss>`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(articlePage))
+	}))
+	t.Cleanup(server.Close)
+
+	const delay = 100 * time.Millisecond
+	Config.PerHostDelay = delay
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL + "/feed", FeedOptions: FeedOptions{Format: "markdown", FullText: true}}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if results := UpdateFeeds([]string{"test-feed"}, false); results[0].Downloaded != 3 {
+		t.Fatalf("expected 3 articles, got %+v", results[0])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(started) != 4 {
+		t.Fatalf("expected the feed and 3 pages to be requested, got %d requests", len(started))
+	}
+	for i := 1; i < len(started); i++ {
+		// Allow for the clock granularity of the test server.
+		if gap := started[i].Sub(started[i-1]); gap < delay-10*time.Millisecond {
+			t.Errorf("expected requests to the feed's host to be spaced by %v, request %d followed after %v", delay, i, gap)
+		}
+	}
+}
@@ -3,22 +3,25 @@ module github.com/h2337/rssnix
 go 1.19
 
 require (
-	github.com/PuerkitoBio/goquery v1.5.1 // indirect
-	github.com/andybalholm/cascadia v1.1.0 // indirect
+	github.com/PuerkitoBio/goquery v1.5.1
+	github.com/andybalholm/cascadia v1.1.0
+	github.com/gilliek/go-opml v1.0.0
+	github.com/go-ini/ini v1.67.0
+	github.com/mmcdole/gofeed v1.1.3
+	github.com/sirupsen/logrus v1.9.0
+	github.com/urfave/cli/v2 v2.23.5
+	golang.org/x/net v0.0.0-20200301022130-244492dfa37a
+	golang.org/x/sys v0.1.0
+)
+
+require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
-	github.com/gilliek/go-opml v1.0.0 // indirect
-	github.com/go-ini/ini v1.67.0 // indirect
 	github.com/json-iterator/go v1.1.10 // indirect
-	github.com/mmcdole/gofeed v1.1.3 // indirect
 	github.com/mmcdole/goxpp v0.0.0-20181012175147-0068e33feabf // indirect
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
 	github.com/modern-go/reflect2 v0.0.0-20180701023420-4b7aa43c6742 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
-	github.com/sirupsen/logrus v1.9.0 // indirect
-	github.com/urfave/cli/v2 v2.23.5 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
 	golang.org/x/exp v0.0.0-20221114191408-850992195362 // indirect
-	golang.org/x/net v0.0.0-20200301022130-244492dfa37a // indirect
-	golang.org/x/sys v0.1.0 // indirect
 	golang.org/x/text v0.3.2 // indirect
 )
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// How images in HTML articles are handled.
+const (
+	htmlImagesRemote = "remote"
+	htmlImagesInline = "inline"
+	htmlImagesLocal  = "local"
+)
+
+// maxImageSize limits the size of a single image embedded in or stored next
+// to an HTML article.
+const maxImageSize = 10 << 20
+
+const htmlArticleStyle = `body{max-width:42em;margin:2em auto;padding:0 1em;font-family:sans-serif;line-height:1.5}` +
+	`header{border-bottom:1px solid #ccc;margin-bottom:1.5em}.meta{color:#666;font-size:.9em}` +
+	`img,video{max-width:100%;height:auto}pre{overflow:auto;background:#f5f5f5;padding:.5em}` +
+	`blockquote{margin-left:0;padding-left:1em;border-left:3px solid #ccc;color:#444}`
+
+// droppedElements are removed from article HTML together with their
+// contents.
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Iframe: true, atom.Frame: true, atom.Frameset: true, atom.Object: true,
+	atom.Embed: true, atom.Applet: true, atom.Form: true, atom.Input: true,
+	atom.Button: true, atom.Textarea: true, atom.Select: true, atom.Link: true,
+	atom.Meta: true, atom.Base: true, atom.Head: true, atom.Title: true,
+	atom.Svg: true, atom.Math: true,
+}
+
+// urlAttributes are attributes holding URLs, which are resolved against the
+// article link and dropped if they use any other scheme than the safe ones.
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "poster": true, "cite": true, "longdesc": true,
+}
+
+// renderHTML writes the item as a standalone HTML page with a small header
+// and the sanitized article content. Depending on the feed's html_images
+// setting, images are left pointing at their original location, embedded
+// as data: URLs or downloaded into a directory next to the article.
+func renderHTML(a *article) ([]byte, error) {
+	item := a.Item
+
+	body := item.Content
+	if strings.TrimSpace(body) == "" {
+		body = item.Description
+	}
+	content, err := sanitizeHTML(body, item.Link, newImageFetcher(a))
+	if err != nil {
+		return nil, fmt.Errorf("sanitize content: %w", err)
+	}
+
+	title := strings.TrimSpace(item.Title)
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	b.WriteString(`<meta charset="utf-8">` + "\n")
+	b.WriteString(`<meta name="viewport" content="width=device-width, initial-scale=1">` + "\n")
+	b.WriteString(`<meta http-equiv="Content-Security-Policy" content="script-src 'none'; object-src 'none'">` + "\n")
+	b.WriteString(`<meta name="referrer" content="no-referrer">` + "\n")
+	b.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	b.WriteString("<style>" + htmlArticleStyle + "</style>\n")
+	b.WriteString("</head>\n<body>\n<article>\n<header>\n")
+	if title != "" {
+		b.WriteString("<h1>" + html.EscapeString(title) + "</h1>\n")
+	}
+
+	var meta []string
+	if a.Feed.Name != "" {
+		meta = append(meta, html.EscapeString(a.Feed.Name))
+	}
+	if author := itemAuthor(item); author != "" {
+		meta = append(meta, html.EscapeString(author))
+	}
+	if item.PublishedParsed != nil {
+		meta = append(meta, `<time datetime="`+item.PublishedParsed.Format(time.RFC3339)+`">`+
+			html.EscapeString(item.PublishedParsed.Format("2 January 2006 15:04"))+"</time>")
+	} else if item.Published != "" {
+		meta = append(meta, html.EscapeString(item.Published))
+	}
+	if link := safeURL(item.Link, nil, false); link != "" {
+		meta = append(meta, `<a href="`+html.EscapeString(link)+`">Original article</a>`)
+	}
+	if len(meta) > 0 {
+		b.WriteString(`<p class="meta">` + strings.Join(meta, " &middot; ") + "</p>\n")
+	}
+	b.WriteString("</header>\n")
+	b.WriteString(content)
+	b.WriteString("\n</article>\n</body>\n</html>\n")
+
+	return []byte(b.String()), nil
+}
+
+// sanitizeHTML returns the HTML fragment s with active content, event
+// handlers, inline styles and unsafe URLs removed and relative URLs
+// resolved against base. Images are passed through images, if given. Input
+// without any markup is turned into paragraphs.
+func sanitizeHTML(s, base string, images *imageFetcher) (string, error) {
+	if !strings.Contains(s, "<") {
+		var paragraphs []string
+		for _, paragraph := range strings.Split(html.UnescapeString(s), "\n\n") {
+			if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+				paragraphs = append(paragraphs, "<p>"+html.EscapeString(paragraph)+"</p>")
+			}
+		}
+		return strings.Join(paragraphs, "\n"), nil
+	}
+
+	nodes, err := parseHTMLFragment(s)
+	if err != nil {
+		return "", err
+	}
+
+	var baseURL *url.URL
+	if parsed, err := url.Parse(base); err == nil && parsed.IsAbs() {
+		baseURL = parsed
+	}
+
+	var out bytes.Buffer
+	for _, node := range nodes {
+		if !keepNode(node) {
+			continue
+		}
+		sanitizeNode(node, baseURL, images)
+		if err := html.Render(&out, node); err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+func keepNode(n *html.Node) bool {
+	switch n.Type {
+	case html.CommentNode, html.DoctypeNode:
+		return false
+	case html.ElementNode:
+		return !droppedElements[n.DataAtom] && n.Namespace == ""
+	}
+	return true
+}
+
+func sanitizeNode(n *html.Node, base *url.URL, images *imageFetcher) {
+	if n.Type == html.ElementNode {
+		attrs := n.Attr[:0]
+		for _, a := range n.Attr {
+			key := strings.ToLower(a.Key)
+			if a.Namespace != "" || strings.HasPrefix(key, "on") || key == "style" || key == "srcset" || key == "sizes" {
+				continue
+			}
+			if urlAttributes[key] {
+				allowData := n.DataAtom == atom.Img && key == "src"
+				if a.Val = safeURL(a.Val, base, allowData); a.Val == "" {
+					continue
+				}
+			}
+			attrs = append(attrs, a)
+		}
+		n.Attr = attrs
+
+		if n.DataAtom == atom.Img && images != nil {
+			for i, a := range n.Attr {
+				if a.Key == "src" {
+					n.Attr[i].Val = images.replace(a.Val)
+				}
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if keepNode(c) {
+			sanitizeNode(c, base, images)
+		} else {
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+// safeURL resolves ref against base and returns it if it uses the http,
+// https, mailto or ftp scheme, or is a data: URL of an image and allowData
+// is set.
+func safeURL(ref string, base *url.URL, allowData bool) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ref
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		parsed = base.ResolveReference(parsed)
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto", "ftp":
+		return parsed.String()
+	case "data":
+		if allowData && strings.HasPrefix(strings.ToLower(parsed.Opaque), "image/") {
+			return ref
+		}
+	case "":
+		// A relative URL that could not be resolved is kept as it is.
+		return parsed.String()
+	}
+	return ""
+}
+
+// imageFetcher downloads the images of an article to inline them or store
+// them next to it.
+type imageFetcher struct {
+	feed  Feed
+	hosts *hostLimiter
+	mode  string
+	dir   string
+	saved map[string]string
+}
+
+// newImageFetcher returns the image fetcher for the article, or nil if its
+// images are left as remote links.
+func newImageFetcher(a *article) *imageFetcher {
+	mode := a.Feed.HTMLImages
+	if mode != htmlImagesInline && mode != htmlImagesLocal {
+		return nil
+	}
+	if mode == htmlImagesLocal && a.Path == "" {
+		return nil
+	}
+	return &imageFetcher{
+		feed:  a.Feed,
+		hosts: a.Hosts,
+		mode:  mode,
+		dir:   articleAssetsDir(a.Path),
+		saved: map[string]string{},
+	}
+}
+
+// articleAssetsDir returns the directory holding the images of the HTML
+// article at articlePath.
+func articleAssetsDir(articlePath string) string {
+	return strings.TrimSuffix(articlePath, filepath.Ext(articlePath)) + "_files"
+}
+
+// removeArticleAssets removes the images stored next to an HTML article.
+func removeArticleAssets(articlePath string) {
+	if filepath.Ext(articlePath) != articleFormats["html"].Extension {
+		return
+	}
+	if err := os.RemoveAll(articleAssetsDir(articlePath)); err != nil {
+		log.WithError(err).Warnf("Failed to remove images of article %s", articlePath)
+	}
+}
+
+// replace downloads the image at src and returns the URL to use in its
+// place. On failure the original URL is kept.
+func (f *imageFetcher) replace(src string) string {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return src
+	}
+	if replacement, ok := f.saved[src]; ok {
+		return replacement
+	}
+
+	replacement := src
+	data, contentType, err := f.download(src)
+	if err != nil {
+		log.WithError(err).Warnf("Failed to download image %s for feed '%s'", src, f.feed.Name)
+	} else if f.mode == htmlImagesInline {
+		replacement = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	} else if name, err := f.store(src, data, contentType); err != nil {
+		log.WithError(err).Warnf("Failed to store image %s for feed '%s'", src, f.feed.Name)
+	} else {
+		replacement = (&url.URL{Path: filepath.Base(f.dir) + "/" + name}).String()
+	}
+
+	f.saved[src] = replacement
+	return replacement
+}
+
+func (f *imageFetcher) download(src string) ([]byte, string, error) {
+	client, err := httpClientFor(f.feed.HTTP)
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, src, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := f.feed.authorize(req); err != nil {
+		return nil, "", err
+	}
+
+	release := f.hosts.acquire(feedHost(src))
+	defer release()
+	resp, err := doWithRetry(client, req, f.feed.HTTP)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxImageSize {
+		return nil, "", fmt.Errorf("image larger than %d bytes", maxImageSize)
+	}
+
+	contentType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("unexpected content type %q", contentType)
+	}
+	return data, contentType, nil
+}
+
+// imageExtensions maps image content types to file extensions.
+var imageExtensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/avif":    ".avif",
+	"image/svg+xml": ".svg",
+	"image/bmp":     ".bmp",
+	"image/x-icon":  ".ico",
+}
+
+func (f *imageFetcher) store(src string, data []byte, contentType string) (string, error) {
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return "", err
+	}
+
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		if parsed, err := url.Parse(src); err == nil {
+			ext = truncateString(safeArticleName(path.Ext(parsed.Path)), 10)
+		}
+	}
+	name := "image-" + strconv.Itoa(len(f.saved)+1) + ext
+	if err := os.WriteFile(filepath.Join(f.dir, name), data, 0o666); err != nil {
+		return "", err
+	}
+	return name, nil
+}
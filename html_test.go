@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Plain &amp; simple\n\nSecond", "<p>Plain &amp; simple</p>\n<p>Second</p>"},
+		{`<p onclick="evil()" style="color:red" class="x">Hi<script>alert(1)</script></p>`, `<p class="x">Hi</p>`},
+		{`<a href="/post">rel</a><a href="javascript:alert(1)">js</a><a href="#note">note</a>`, `<a href="https://example.com/post">rel</a><a>js</a><a href="#note">note</a>`},
+		{`<img src="img.png" srcset="a.png 2x"><img src="data:image/png;base64,AAAA"><a href="data:text/html,x">d</a>`, `<img src="https://example.com/img.png"/><img src="data:image/png;base64,AAAA"/><a>d</a>`},
+		{`<div><iframe src="https://evil.example/"></iframe><!-- c --><svg><script>x</script></svg>ok</div>`, `<div>ok</div>`},
+	}
+
+	for _, tc := range tests {
+		got, err := sanitizeHTML(tc.input, "https://example.com/article", nil)
+		if err != nil {
+			t.Fatalf("sanitizeHTML(%q) returned error: %v", tc.input, err)
+		}
+		if got != tc.want {
+			t.Errorf("sanitizeHTML(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	item := &gofeed.Item{
+		Title:     "A <b>title</b>",
+		Link:      "https://example.com/article",
+		Published: "yesterday",
+		Content:   `<p>Body</p>`,
+	}
+
+	content, err := renderHTML(&article{Feed: Feed{Name: "test-feed"}, Item: item})
+	if err != nil {
+		t.Fatalf("renderHTML returned error: %v", err)
+	}
+
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"<title>A &lt;b&gt;title&lt;/b&gt;</title>",
+		"<h1>A &lt;b&gt;title&lt;/b&gt;</h1>",
+		`<p class="meta">test-feed &middot; yesterday &middot; <a href="https://example.com/article">Original article</a></p>`,
+		"<p>Body</p>",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected HTML to contain %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestRenderHTMLImages(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/img.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(png)
+	}))
+	t.Cleanup(server.Close)
+
+	item := &gofeed.Item{
+		Title:   "Post",
+		Link:    server.URL + "/post",
+		Content: `<img src="/img.png"><img src="img.png"><img src="/missing.png">`,
+	}
+	feed := Feed{Name: "test-feed", URL: server.URL, FeedOptions: defaultFeedOptions()}
+
+	feed.HTMLImages = htmlImagesInline
+	content, err := renderHTML(&article{Feed: feed, Item: item})
+	if err != nil {
+		t.Fatalf("renderHTML returned error: %v", err)
+	}
+	if !strings.Contains(string(content), `<img src="data:image/png;base64,iVBORw0KGgowMDAw"/><img src="data:image/png;base64,iVBORw0KGgowMDAw"/><img src="`+server.URL+`/missing.png"/>`) {
+		t.Fatalf("expected inlined images and failed image kept remote:\n%s", content)
+	}
+
+	feed.HTMLImages = htmlImagesLocal
+	articlePath := filepath.Join(t.TempDir(), "Post.html")
+	content, err = renderHTML(&article{Feed: feed, Item: item, Path: articlePath})
+	if err != nil {
+		t.Fatalf("renderHTML returned error: %v", err)
+	}
+	if !strings.Contains(string(content), `<img src="Post_files/image-1.png"/><img src="Post_files/image-1.png"/>`) {
+		t.Fatalf("expected images stored next to the article:\n%s", content)
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(articlePath), "Post_files", "image-1.png"))
+	if err != nil || string(data) != string(png) {
+		t.Fatalf("expected stored image, got %q (%v)", data, err)
+	}
+
+	removeArticleAssets(articlePath)
+	if _, err := os.Stat(articleAssetsDir(articlePath)); !os.IsNotExist(err) {
+		t.Fatalf("expected images to be removed with the article")
+	}
+}
+
+func TestRenderHTMLImagesWithinHostLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n0000"))
+	}))
+	t.Cleanup(server.Close)
+
+	item := &gofeed.Item{Title: "Post", Link: server.URL + "/post", Content: `<img src="/a.png"><img src="/b.png"><img src="/c.png">`}
+	feed := Feed{Name: "test-feed", URL: server.URL, FeedOptions: defaultFeedOptions()}
+	feed.HTMLImages = htmlImagesInline
+
+	const delay = 50 * time.Millisecond
+	start := time.Now()
+	if _, err := renderHTML(&article{Feed: feed, Item: item, Hosts: newHostLimiter(1, delay, nil)}); err != nil {
+		t.Fatalf("renderHTML returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*delay {
+		t.Fatalf("expected image downloads to be spaced by %v, took %v in total", delay, elapsed)
+	}
+}
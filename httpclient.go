@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ini/ini"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTimeout      = 30 * time.Second
+	defaultRetries      = 2
+	defaultRetryBackoff = time.Second
+
+	maxRetryBackoff = time.Minute
+	maxRetryAfter   = 2 * time.Minute
+
+	// maxRedirects matches the limit of http.Client's default policy.
+	maxRedirects = 10
+)
+
+// HTTPOptions controls how feeds are fetched. HeaderTimeout is not read
+// from the config; it limits the wait for response headers of requests
+// whose total duration is not limited by Timeout.
+type HTTPOptions struct {
+	Timeout       time.Duration
+	HeaderTimeout time.Duration
+	UserAgent     string
+	Proxy         string
+	Retries       int
+	RetryBackoff  time.Duration
+}
+
+func defaultHTTPOptions() HTTPOptions {
+	return HTTPOptions{
+		Timeout:      defaultTimeout,
+		UserAgent:    defaultUserAgent(),
+		Retries:      defaultRetries,
+		RetryBackoff: defaultRetryBackoff,
+	}
+}
+
+func defaultUserAgent() string {
+	return "rssnix/" + Version
+}
+
+// loadHTTPOptions returns defaults overridden by any HTTP keys present in
+// section.
+func loadHTTPOptions(section *ini.Section, defaults HTTPOptions) (HTTPOptions, error) {
+	opts := defaults
+	var err error
+
+	if opts.Timeout, err = durationSetting(section, "timeout", defaults.Timeout); err != nil {
+		return opts, err
+	}
+	if userAgent := strings.TrimSpace(section.Key("user_agent").String()); userAgent != "" {
+		opts.UserAgent = userAgent
+	}
+	if section.HasKey("proxy") {
+		opts.Proxy = strings.TrimSpace(section.Key("proxy").String())
+		if _, err := parseProxyURL(opts.Proxy); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Retries, err = intSetting(section, "retries", 0, defaults.Retries); err != nil {
+		return opts, err
+	}
+	if opts.RetryBackoff, err = durationSetting(section, "retry_backoff", defaults.RetryBackoff); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+		return proxyURL, nil
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: scheme must be http, https or socks5", raw)
+	}
+}
+
+var httpClients sync.Map
+
+// httpClientFor returns a client configured for opts. Clients are shared
+// between feeds with identical options so connections can be reused.
+func httpClientFor(opts HTTPOptions) (*http.Client, error) {
+	if client, ok := httpClients.Load(opts); ok {
+		return client.(*http.Client), nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = opts.HeaderTimeout
+	proxyURL, err := parseProxyURL(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	client, _ := httpClients.LoadOrStore(opts, &http.Client{
+		Timeout:       opts.Timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	})
+	return client.(*http.Client), nil
+}
+
+// checkRedirect follows redirects like the default policy. Once a redirect
+// leaves the host of the original request, the feed's custom headers are
+// dropped as well; Go already drops Authorization and Cookie itself.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+		if names, ok := req.Context().Value(customHeadersKey{}).([]string); ok {
+			for _, name := range names {
+				req.Header.Del(name)
+			}
+		}
+	}
+	return nil
+}
+
+// doWithRetry sends req, retrying transient failures with exponential
+// backoff. A Retry-After header on 429 and 503 responses takes precedence
+// over the computed backoff.
+func doWithRetry(client *http.Client, req *http.Request, opts HTTPOptions) (*http.Response, error) {
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt >= opts.Retries || !isRetryable(resp, err) {
+			return resp, err
+		}
+
+		wait := retryBackoff(opts.RetryBackoff, attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > maxRetryAfter {
+					return resp, nil
+				}
+				wait = retryAfter
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+		}
+		log.Debugf("Retrying %s in %v after %s (attempt %d of %d)", req.URL, wait, reason, attempt+1, opts.Retries)
+		time.Sleep(wait)
+	}
+}
+
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+		// Every error from client.Do is a net.Error, so only timeouts and
+		// dropped connections count as transient; refused connections, TLS
+		// failures and bad URLs are not retried. A connection reset shows up
+		// as a failed read on every platform.
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return true
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "read" {
+			return true
+		}
+		var netErr net.Error
+		return errors.As(err, &netErr) && netErr.Timeout()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	wait := base
+	for i := 0; i < attempt && wait < maxRetryBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryBackoff {
+		wait = maxRetryBackoff
+	}
+	return wait
+}
+
+// parseRetryAfter interprets a Retry-After header given either as a number
+// of seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoWithRetryHonoursRetryAfter(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if got := r.Header.Get("User-Agent"); got != "custom-agent" {
+			t.Errorf("expected custom User-Agent, got %q", got)
+		}
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	opts := HTTPOptions{UserAgent: "custom-agent", Retries: 2, RetryBackoff: time.Hour}
+	client, err := httpClientFor(opts)
+	if err != nil {
+		t.Fatalf("httpClientFor returned error: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := doWithRetry(client, req, opts)
+	if err != nil {
+		t.Fatalf("doWithRetry returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || requests != 2 {
+		t.Fatalf("expected success on second attempt, got status %d after %d requests", resp.StatusCode, requests)
+	}
+}
+
+func TestDoWithRetryGivesUp(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+
+	opts := HTTPOptions{Retries: 2, RetryBackoff: time.Millisecond}
+	client, err := httpClientFor(opts)
+	if err != nil {
+		t.Fatalf("httpClientFor returned error: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := doWithRetry(client, req, opts)
+	if err != nil {
+		t.Fatalf("doWithRetry returned error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway || requests != 3 {
+		t.Fatalf("expected 3 attempts ending in 502, got status %d after %d requests", resp.StatusCode, requests)
+	}
+}
+
+func TestDoWithRetrySkipsPermanentErrors(t *testing.T) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	const backoff = 500 * time.Millisecond
+	opts := HTTPOptions{Retries: 2, RetryBackoff: backoff}
+	client, err := httpClientFor(opts)
+	if err != nil {
+		t.Fatalf("httpClientFor returned error: %v", err)
+	}
+
+	for _, rawURL := range []string{"ftp://example.com/feed.xml", server.URL} {
+		req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		resp, err := doWithRetry(client, req, opts)
+		if err == nil {
+			resp.Body.Close()
+			t.Fatalf("expected %s to fail", rawURL)
+		}
+		if isRetryable(nil, err) {
+			t.Errorf("expected %v not to be retryable", err)
+		}
+		if elapsed := time.Since(start); elapsed >= backoff {
+			t.Errorf("expected %s not to be retried, took %v", rawURL, elapsed)
+		}
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Fatalf("expected a single connection to the TLS server, got %d", n)
+	}
+}
+
+func TestDoWithRetryRetriesResetConnections(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// Closing with a zero linger time sends a reset.
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+
+	opts := HTTPOptions{Retries: 1, RetryBackoff: time.Millisecond}
+	client, err := httpClientFor(opts)
+	if err != nil {
+		t.Fatalf("httpClientFor returned error: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := doWithRetry(client, req, opts)
+	if err != nil {
+		t.Fatalf("doWithRetry returned error: %v", err)
+	}
+	resp.Body.Close()
+	if n := atomic.LoadInt32(&requests); resp.StatusCode != http.StatusOK || n != 2 {
+		t.Fatalf("expected the reset connection to be retried, got status %d after %d requests", resp.StatusCode, n)
+	}
+
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	if !isRetryable(nil, &url.Error{Op: "Get", URL: server.URL, Err: reset}) {
+		t.Fatalf("expected a failed read to be retryable")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	if got, ok := parseRetryAfter("120", now); !ok || got != 2*time.Minute {
+		t.Errorf("expected 2m from seconds, got %v (%v)", got, ok)
+	}
+	if got, ok := parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now); !ok || got != 30*time.Second {
+		t.Errorf("expected 30s from HTTP date, got %v (%v)", got, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Errorf("expected invalid value to be rejected")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	if got := retryBackoff(time.Second, 0); got != time.Second {
+		t.Errorf("expected first backoff to equal base, got %v", got)
+	}
+	if got := retryBackoff(time.Second, 3); got != 8*time.Second {
+		t.Errorf("expected backoff to double per attempt, got %v", got)
+	}
+	if got := retryBackoff(time.Second, 20); got != maxRetryBackoff {
+		t.Errorf("expected backoff to be capped at %v, got %v", maxRetryBackoff, got)
+	}
+}
+
+func TestLoadHTTPOptions(t *testing.T) {
+	cfg, err := loadINI([]byte("[settings]\ntimeout = 5s\nuser_agent = agent\nproxy = socks5://localhost:1080\nretries = 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := loadHTTPOptions(cfg.Section("settings"), defaultHTTPOptions())
+	if err != nil {
+		t.Fatalf("loadHTTPOptions returned error: %v", err)
+	}
+	want := HTTPOptions{Timeout: 5 * time.Second, UserAgent: "agent", Proxy: "socks5://localhost:1080", Retries: 0, RetryBackoff: defaultRetryBackoff}
+	if opts != want {
+		t.Fatalf("expected %+v, got %+v", want, opts)
+	}
+
+	cfg, err = loadINI([]byte("[settings]\nproxy = ftp://localhost\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadHTTPOptions(cfg.Section("settings"), defaultHTTPOptions()); err == nil {
+		t.Fatalf("expected unsupported proxy scheme to be rejected")
+	}
+}
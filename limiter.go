@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostLimiter bounds the number of concurrent requests made to a single host
+// and spaces out the start of consecutive requests to it.
+type hostLimiter struct {
+	limit int
+	delay time.Duration
+	// global, if set, is the semaphore bounding the number of feeds updated
+	// at once, of which every caller of acquire holds a slot. The slot is
+	// given up while waiting for the host, so that feeds queued for a busy
+	// host do not keep feeds on other hosts from being updated.
+	global chan struct{}
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+type hostSlot struct {
+	sem chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newHostLimiter(limit int, delay time.Duration, global chan struct{}) *hostLimiter {
+	if limit < 1 {
+		limit = 1
+	}
+	return &hostLimiter{limit: limit, delay: delay, global: global, hosts: map[string]*hostSlot{}}
+}
+
+// acquire blocks until a request to host may start and returns a function
+// that must be called once the request has finished. A nil limiter never
+// blocks.
+func (l *hostLimiter) acquire(host string) func() {
+	if l == nil {
+		return func() {}
+	}
+	l.mu.Lock()
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlot{sem: make(chan struct{}, l.limit)}
+		l.hosts[host] = slot
+	}
+	l.mu.Unlock()
+
+	if l.global != nil {
+		<-l.global
+	}
+	slot.sem <- struct{}{}
+
+	slot.mu.Lock()
+	now := time.Now()
+	start := slot.next
+	if start.Before(now) {
+		start = now
+	}
+	slot.next = start.Add(l.delay)
+	slot.mu.Unlock()
+
+	time.Sleep(time.Until(start))
+	if l.global != nil {
+		l.global <- struct{}{}
+	}
+
+	return func() { <-slot.sem }
+}
+
+// feedHost returns the host a feed URL is fetched from, used as the key for
+// per-host limits.
+func feedHost(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+	return strings.ToLower(parsed.Hostname())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterBoundsConcurrency(t *testing.T) {
+	limiter := newHostLimiter(2, 0, nil)
+
+	var active, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := limiter.acquire("example.com")
+			defer release()
+			n := atomic.AddInt32(&active, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent requests per host, got %d", peak)
+	}
+}
+
+func TestHostLimiterSpacesRequests(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	limiter := newHostLimiter(3, delay, nil)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.acquire("example.com")()
+	}
+	if elapsed := time.Since(start); elapsed < 2*delay {
+		t.Fatalf("expected requests to be spaced by %v, took %v in total", delay, elapsed)
+	}
+
+	start = time.Now()
+	limiter.acquire("other.example.com")()
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Fatalf("expected other hosts not to be delayed, took %v", elapsed)
+	}
+}
+
+func TestFeedHost(t *testing.T) {
+	tests := map[string]string{
+		"https://Example.com:8080/feed.xml": "example.com",
+		"http://example.org/rss":            "example.org",
+		"not a url":                         "not a url",
+	}
+	for input, want := range tests {
+		if got := feedHost(input); got != want {
+			t.Errorf("feedHost(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// feedStatus summarises a feed's subscription and what is stored on disk.
+type feedStatus struct {
+	Name         string     `json:"name"`
+	URL          string     `json:"url"`
+	Category     string     `json:"category,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	Articles     int        `json:"articles"`
+	New          int        `json:"new"`
+	LastFetch    *time.Time `json:"last_fetch,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+	ItemsPerWeek float64    `json:"items_per_week"`
+}
+
+func collectFeedStatus(feed Feed) feedStatus {
+	status := feedStatus{Name: feed.Name, URL: feed.URL, Category: feed.Category}
+
+	state, err := loadFeedState(feed.dir())
+	if err != nil {
+		log.WithError(err).Warnf("Failed to read state of feed '%s'", feed.Name)
+		return status
+	}
+
+	status.Title = state.Title
+	if !state.LastFetch.IsZero() {
+		status.LastFetch = &state.LastFetch
+	}
+	if state.LastError != "" {
+		status.LastError = state.LastError
+		status.LastErrorAt = &state.LastErrorAt
+	}
+
+	for _, seen := range state.Items {
+		if seen.File != "" {
+			status.Articles++
+		}
+	}
+	status.ItemsPerWeek = itemsPerWeek(state)
+	if formatFor(feed).Maildir {
+		status.New = countMaildirNew(feed.dir())
+	} else {
+		status.New = countNewLinks(feed.dir())
+	}
+
+	return status
+}
+
+// itemsPerWeek returns the average number of items per week between the
+// oldest and newest item in the index, counting at least one week.
+func itemsPerWeek(state *feedState) float64 {
+	if len(state.Items) == 0 {
+		return 0
+	}
+
+	var oldest, newest time.Time
+	for _, seen := range state.Items {
+		date := seen.date()
+		if oldest.IsZero() || date.Before(oldest) {
+			oldest = date
+		}
+		if date.After(newest) {
+			newest = date
+		}
+	}
+
+	const week = 7 * 24 * time.Hour
+	weeks := float64(newest.Sub(oldest)) / float64(week)
+	if weeks < 1 {
+		weeks = 1
+	}
+	return float64(len(state.Items)) / weeks
+}
+
+// countNewLinks counts the symlinks in the new article directory that lead
+// into feedDir.
+func countNewLinks(feedDir string) int {
+	root := filepath.Join(Config.FeedDirectory, newArticleDirectory)
+	prefix := feedDir + string(filepath.Separator)
+
+	count := 0
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if target, err := os.Readlink(path); err == nil && strings.HasPrefix(target, prefix) {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+func writeFeedStatusJSON(w io.Writer, statuses []feedStatus) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+func writeFeedStatusTable(w io.Writer, statuses []feedStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCATEGORY\tARTICLES\tNEW\tLAST FETCH\tPER WEEK\tLAST ERROR\tURL")
+	for _, status := range statuses {
+		lastFetch := "never"
+		if status.LastFetch != nil {
+			lastFetch = status.LastFetch.Local().Format("2006-01-02 15:04")
+		}
+		lastError := "-"
+		if status.LastError != "" {
+			lastError = status.LastErrorAt.Local().Format("2006-01-02 15:04") + " " + truncateString(status.LastError, 60)
+		}
+		category := status.Category
+		if category == "" {
+			category = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			status.Name, category, status.Articles, status.New, lastFetch,
+			strconv.FormatFloat(status.ItemsPerWeek, 'f', 1, 64), lastError, status.URL)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectFeedStatus(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title>` +
+			`<item><title>One</title><guid>1</guid></item><item><title>Two</title><guid>2</guid></item>` +
+			`</channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL, Category: "Tech"}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if _, err := UpdateFeed("test-feed", false); err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+
+	status := collectFeedStatus(Config.Feeds[0])
+	if status.Articles != 2 || status.New != 2 || status.LastFetch == nil || status.Title != "Test Feed" || status.LastError != "" {
+		t.Fatalf("unexpected status after successful update: %+v", status)
+	}
+	if status.ItemsPerWeek != 2 {
+		t.Fatalf("expected 2 items per week, got %v", status.ItemsPerWeek)
+	}
+
+	failing = true
+	if _, err := UpdateFeed("test-feed", false); err == nil {
+		t.Fatalf("expected UpdateFeed to fail")
+	}
+
+	status = collectFeedStatus(Config.Feeds[0])
+	if status.LastError == "" || status.LastErrorAt == nil {
+		t.Fatalf("expected last error to be recorded, got %+v", status)
+	}
+	if status.Articles != 2 {
+		t.Fatalf("expected failed fetch to keep the index, got %d articles", status.Articles)
+	}
+
+	var table bytes.Buffer
+	if err := writeFeedStatusTable(&table, []feedStatus{status}); err != nil {
+		t.Fatalf("writeFeedStatusTable returned error: %v", err)
+	}
+	if !strings.Contains(table.String(), "test-feed") || !strings.Contains(table.String(), "Tech") {
+		t.Fatalf("expected table to list the feed, got:\n%s", table.String())
+	}
+
+	var encoded bytes.Buffer
+	if err := writeFeedStatusJSON(&encoded, []feedStatus{status}); err != nil {
+		t.Fatalf("writeFeedStatusJSON returned error: %v", err)
+	}
+	var decoded []feedStatus
+	if err := json.Unmarshal(encoded.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].Name != "test-feed" {
+		t.Fatalf("expected JSON list with the feed, got %s (%v)", encoded.String(), err)
+	}
+}
+
+func TestItemsPerWeek(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := newFeedState()
+	for i := 0; i < 9; i++ {
+		published := start.Add(time.Duration(i) * 3 * 24 * time.Hour)
+		state.Items[string(rune('a'+i))] = &seenItem{Published: &published}
+	}
+
+	// Nine items spread over 24 days.
+	if got, want := itemsPerWeek(state), 9/(24.0/7); got != want {
+		t.Fatalf("expected %v items per week, got %v", want, got)
+	}
+	if got := itemsPerWeek(newFeedState()); got != 0 {
+		t.Fatalf("expected no items per week for an empty index, got %v", got)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Subdirectories of a Maildir folder.
+const (
+	maildirTmp = "tmp"
+	maildirNew = "new"
+	maildirCur = "cur"
+)
+
+var maildirDeliveries uint64
+
+// renderMail writes the item as an RFC 5322 message with a plain-text and
+// an HTML alternative of its content.
+func renderMail(a *article) ([]byte, error) {
+	item := a.Item
+
+	host := mailHost(a.Feed)
+	from := mail.Address{Name: a.Feed.Name, Address: "rssnix@" + host}
+	person := item.Author
+	if len(item.Authors) > 0 {
+		person = item.Authors[0]
+	}
+	if person != nil {
+		if person.Name != "" {
+			from.Name = person.Name
+		}
+		if person.Email != "" {
+			from.Address = person.Email
+		}
+	}
+
+	date := time.Now()
+	if item.PublishedParsed != nil {
+		date = *item.PublishedParsed
+	} else if item.UpdatedParsed != nil {
+		date = *item.UpdatedParsed
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	var b strings.Builder
+	writeMailHeader(&b, "From", from.String())
+	writeMailHeader(&b, "Date", date.Format(time.RFC1123Z))
+	writeMailHeader(&b, "Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(item.Title)))
+	writeMailHeader(&b, "Message-ID", messageID(itemKey(item), host))
+	writeMailHeader(&b, "X-RSS-Feed", mime.QEncoding.Encode("utf-8", a.Feed.Name))
+	writeMailHeader(&b, "X-RSS-Link", item.Link)
+	writeMailHeader(&b, "MIME-Version", "1.0")
+	writeMailHeader(&b, "Content-Type", `multipart/alternative; boundary="`+parts.Boundary()+`"`)
+	b.WriteString("\r\n")
+
+	content := item.Content
+	if strings.TrimSpace(content) == "" {
+		content = item.Description
+	}
+
+	text, err := htmlToText(content, item.Link, textWidth)
+	if err != nil {
+		return nil, fmt.Errorf("convert content to text: %w", err)
+	}
+	if item.Link != "" {
+		text = strings.TrimSpace(text + "\n\n" + item.Link)
+	}
+	if err := writeMailPart(parts, "text/plain", text+"\n"); err != nil {
+		return nil, err
+	}
+
+	sanitized, err := sanitizeHTML(content, item.Link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("sanitize content: %w", err)
+	}
+	if link := safeURL(item.Link, nil, false); link != "" {
+		sanitized += "\n<p><a href=\"" + html.EscapeString(link) + "\">Original article</a></p>"
+	}
+	if err := writeMailPart(parts, "text/html", "<!DOCTYPE html>\n<html>\n<body>\n"+sanitized+"\n</body>\n</html>\n"); err != nil {
+		return nil, err
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(b.String()), body.Bytes()...), nil
+}
+
+// mailHost returns the domain used in the addresses and message IDs of the
+// feed's messages.
+func mailHost(feed Feed) string {
+	host := feedHost(feed.URL)
+	if host == "" || strings.ContainsAny(host, "/:") {
+		return "localhost"
+	}
+	return host
+}
+
+// messageID derives a stable message ID from the key of an item.
+func messageID(key, host string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "<" + hex.EncodeToString(sum[:16]) + "@" + host + ">"
+}
+
+func writeMailHeader(b *strings.Builder, key, value string) {
+	if value == "" {
+		return
+	}
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	b.WriteString(key + ": " + value + "\r\n")
+}
+
+func writeMailPart(parts *multipart.Writer, contentType, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+"; charset=utf-8")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := parts.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(content, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// storeMaildirMessage renders a in the given format and delivers it into
+// the feed's Maildir folder, returning the file name relative to feedDir.
+func storeMaildirMessage(a *article, feedDir string, format articleFormat) (string, error) {
+	message, err := format.Render(a)
+	if err != nil {
+		return "", fmt.Errorf("render message: %w", err)
+	}
+	file, err := deliverMaildir(feedDir, message)
+	if err != nil {
+		return "", fmt.Errorf("deliver message: %w", err)
+	}
+	if date := itemDate(a.Item); date != nil {
+		os.Chtimes(filepath.Join(feedDir, file), time.Now(), *date)
+	}
+	return file, nil
+}
+
+// deliverMaildir stores message in the Maildir folder at dir, creating the
+// folder if needed. The message is written to tmp/ first and then moved to
+// new/, as the Maildir format requires. The returned file name is relative
+// to dir.
+func deliverMaildir(dir string, message []byte) (string, error) {
+	for _, sub := range []string{maildirTmp, maildirNew, maildirCur} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return "", err
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	hostname = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(hostname)
+
+	now := time.Now()
+	unique := strconv.FormatInt(now.Unix(), 10) +
+		".M" + strconv.Itoa(now.Nanosecond()/1000) +
+		"P" + strconv.Itoa(os.Getpid()) +
+		"Q" + strconv.FormatUint(atomic.AddUint64(&maildirDeliveries, 1), 10) +
+		"." + hostname
+
+	tmpPath := filepath.Join(dir, maildirTmp, unique)
+	if err := os.WriteFile(tmpPath, message, 0o600); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, maildirNew, unique)); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return filepath.Join(maildirNew, unique), nil
+}
+
+// findMaildirMessage returns the current path of a message delivered as
+// file, which the mail client may have moved to cur/ and given flags.
+func findMaildirMessage(dir, file string) (string, error) {
+	unique := filepath.Base(file)
+	if path := filepath.Join(dir, maildirNew, unique); fileExists(path) {
+		return path, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, maildirCur, globEscape(unique)+"*"))
+	if err != nil {
+		return "", err
+	}
+	for _, match := range matches {
+		if name := filepath.Base(match); name == unique || strings.HasPrefix(name, unique+":") {
+			return match, nil
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+// countMaildirNew counts the unread messages in the new/ directory of the
+// Maildir folder at dir.
+func countMaildirNew(dir string) int {
+	entries, err := os.ReadDir(filepath.Join(dir, maildirNew))
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			count++
+		}
+	}
+	return count
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func globEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace(s)
+}
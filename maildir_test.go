@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestRenderMail(t *testing.T) {
+	published := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	item := &gofeed.Item{
+		Title:           "Grüße",
+		Link:            "https://example.com/article",
+		Content:         `<p>Hello <a href="/more">world</a></p>`,
+		PublishedParsed: &published,
+		Author:          &gofeed.Person{Name: "Jane"},
+		GUID:            "guid-1",
+	}
+
+	message, err := renderMail(&article{Feed: Feed{Name: "test-feed", URL: "https://example.com/feed"}, Item: item})
+	if err != nil {
+		t.Fatalf("renderMail returned error: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		t.Fatalf("ReadMessage returned error: %v", err)
+	}
+	if from := msg.Header.Get("From"); from != `"Jane" <rssnix@example.com>` {
+		t.Errorf("unexpected From %q", from)
+	}
+	if date, err := msg.Header.Date(); err != nil || !date.Equal(published) {
+		t.Errorf("unexpected Date %v (%v)", date, err)
+	}
+	if subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); err != nil || subject != "Grüße" {
+		t.Errorf("unexpected Subject %q (%v)", subject, err)
+	}
+	messageID := msg.Header.Get("Message-ID")
+	if !strings.HasPrefix(messageID, "<") || !strings.HasSuffix(messageID, "@example.com>") {
+		t.Errorf("unexpected Message-ID %q", messageID)
+	}
+	again, _ := renderMail(&article{Feed: Feed{Name: "test-feed", URL: "https://example.com/feed"}, Item: item})
+	if !strings.Contains(string(again), "Message-ID: "+messageID) {
+		t.Errorf("expected Message-ID to be derived from the GUID")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected Content-Type %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	bodies := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart returned error: %v", err)
+		}
+		data, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[contentType] = string(data)
+	}
+	if !strings.Contains(bodies["text/plain"], "Hello world [1]") || !strings.Contains(bodies["text/plain"], "[1] https://example.com/more") {
+		t.Errorf("unexpected text part %q", bodies["text/plain"])
+	}
+	if !strings.Contains(bodies["text/html"], `<p>Hello <a href="https://example.com/more">world</a></p>`) {
+		t.Errorf("unexpected HTML part %q", bodies["text/html"])
+	}
+}
+
+func TestDeliverMaildir(t *testing.T) {
+	dir := t.TempDir()
+
+	file, err := deliverMaildir(dir, []byte("Subject: test\r\n\r\nbody\r\n"))
+	if err != nil {
+		t.Fatalf("deliverMaildir returned error: %v", err)
+	}
+	if filepath.Dir(file) != maildirNew {
+		t.Fatalf("expected message in new/, got %q", file)
+	}
+	for _, sub := range []string{maildirTmp, maildirCur} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err != nil || !info.IsDir() {
+			t.Fatalf("expected %s/ to exist: %v", sub, err)
+		}
+	}
+	if countMaildirNew(dir) != 1 {
+		t.Fatalf("expected one new message")
+	}
+
+	read := filepath.Join(dir, maildirCur, filepath.Base(file)+":2,S")
+	if err := os.Rename(filepath.Join(dir, file), read); err != nil {
+		t.Fatal(err)
+	}
+	if path, err := findMaildirMessage(dir, file); err != nil || path != read {
+		t.Fatalf("expected message to be found in cur/, got %q (%v)", path, err)
+	}
+	if countMaildirNew(dir) != 0 {
+		t.Fatalf("expected no new messages")
+	}
+}
+
+func TestUpdateFeedDeliversToMaildir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	body := `<rss version="2.0"><channel><title>Test Feed</title>` +
+		`<item><title>Old</title><guid>1</guid><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>` +
+		`</channel></rss>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{Name: "test-feed", URL: server.URL, FeedOptions: FeedOptions{Format: "maildir", MaxArticles: 1}}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	if result, err := UpdateFeed("test-feed", false); err != nil || result.Downloaded != 1 {
+		t.Fatalf("expected one delivered message, got %+v (%v)", result, err)
+	}
+
+	feedDir := filepath.Join(Config.FeedDirectory, "test-feed")
+	entries, err := os.ReadDir(filepath.Join(feedDir, maildirNew))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one message in new/, got %d (%v)", len(entries), err)
+	}
+	if links, _ := os.ReadDir(filepath.Join(Config.FeedDirectory, newArticleDirectory)); len(links) != 0 {
+		t.Fatalf("expected no symlinks for Maildir feeds, got %d", len(links))
+	}
+
+	// The mail client marks the message as read.
+	read := filepath.Join(feedDir, maildirCur, entries[0].Name()+":2,S")
+	if err := os.Rename(filepath.Join(feedDir, maildirNew, entries[0].Name()), read); err != nil {
+		t.Fatal(err)
+	}
+
+	body = `<rss version="2.0"><channel><title>Test Feed</title>` +
+		`<item><title>New</title><guid>2</guid><pubDate>Tue, 03 Jan 2006 15:04:05 GMT</pubDate></item>` +
+		`</channel></rss>`
+	if result, err := UpdateFeed("test-feed", false); err != nil || result.Downloaded != 1 {
+		t.Fatalf("expected one delivered message, got %+v (%v)", result, err)
+	}
+	if _, err := os.Stat(read); !os.IsNotExist(err) {
+		t.Fatalf("expected read message beyond max_articles to be removed")
+	}
+	if countMaildirNew(feedDir) != 1 {
+		t.Fatalf("expected the new message to remain unread")
+	}
+}
@@ -16,43 +16,279 @@ import (
 
 const Version = "0.4.1"
 
-func addFeed(name, url string) error {
+// editConfig loads the config file, applies edit to it and saves the result.
+func editConfig(edit func(cfg *ini.File) error) error {
+	cfgPath, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadINI(cfgPath)
+	if err != nil {
+		return fmt.Errorf("load config for update: %w", err)
+	}
+
+	if err := edit(cfg); err != nil {
+		return err
+	}
+
+	if err := cfg.SaveTo(cfgPath); err != nil {
+		return fmt.Errorf("persist feed configuration: %w", err)
+	}
+	return nil
+}
+
+// feedListSection returns the [feeds] or [feeds.<Category>] section listing
+// the named feed, if any.
+func feedListSection(cfg *ini.File, name string) *ini.Section {
+	for _, section := range cfg.Sections() {
+		if _, ok := categoryFromFeedsSection(section.Name()); ok && section.HasKey(name) {
+			return section
+		}
+	}
+	return nil
+}
+
+func addFeed(name, url, category string) error {
 	sanitizedName := strings.TrimSpace(name)
 	sanitizedURL := strings.TrimSpace(url)
+	sanitizedCategory := normaliseCategory(category)
 
-	if sanitizedName == "" {
-		return errors.New("feed name cannot be empty")
+	if err := validateFeedName(sanitizedName); err != nil {
+		return err
 	}
 	if sanitizedURL == "" {
 		return errors.New("feed URL cannot be empty")
 	}
 
-	cfgPath, err := configFilePath()
+	feed := Feed{Name: sanitizedName, URL: sanitizedURL, Category: sanitizedCategory, FeedOptions: Config.Defaults}
+	if err := validateFeedLayout(append(Config.Feeds[:len(Config.Feeds):len(Config.Feeds)], feed)); err != nil {
+		return err
+	}
+
+	err := editConfig(func(cfg *ini.File) error {
+		if feedListSection(cfg, sanitizedName) != nil {
+			return fmt.Errorf("feed named '%s' already exists", sanitizedName)
+		}
+		if section, err := cfg.GetSection(feedSectionName(sanitizedName)); err == nil && section.HasKey("url") {
+			return fmt.Errorf("feed named '%s' already exists", sanitizedName)
+		}
+
+		if sanitizedCategory == "" {
+			cfg.Section("feeds").Key(sanitizedName).SetValue(sanitizedURL)
+		} else {
+			section := cfg.Section(feedSectionName(sanitizedName))
+			section.Key("url").SetValue(sanitizedURL)
+			section.Key("category").SetValue(sanitizedCategory)
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	cfg, err := ini.Load(cfgPath)
+	Config.Feeds = append(Config.Feeds, feed)
+
+	return nil
+}
+
+// removeFeed deletes a feed from the config, and its articles as well if
+// deleteFiles is set.
+func removeFeed(name string, deleteFiles bool) error {
+	feed, ok := Config.FeedByName(name)
+	if !ok {
+		return fmt.Errorf("feed %q not found", name)
+	}
+
+	err := editConfig(func(cfg *ini.File) error {
+		if section := feedListSection(cfg, name); section != nil {
+			section.DeleteKey(name)
+		}
+		cfg.DeleteSection(feedSectionName(name))
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("load config for update: %w", err)
+		return err
+	}
+
+	if deleteFiles {
+		if err := DeleteFeedFiles(name); err != nil {
+			return fmt.Errorf("delete articles of feed %q: %w", name, err)
+		}
+		retargetNewLinks(feed.dir(), "")
 	}
 
-	feedsSection := cfg.Section("feeds")
-	if feedsSection.HasKey(sanitizedName) {
-		return fmt.Errorf("feed named '%s' already exists", sanitizedName)
+	for i := range Config.Feeds {
+		if Config.Feeds[i].Name == name {
+			Config.Feeds = append(Config.Feeds[:i], Config.Feeds[i+1:]...)
+			break
+		}
 	}
 
-	feedsSection.Key(sanitizedName).SetValue(sanitizedURL)
+	return nil
+}
 
-	if err := cfg.SaveTo(cfgPath); err != nil {
-		return fmt.Errorf("persist feed configuration: %w", err)
+// renameFeed renames a feed in the config and moves its articles to the
+// directory matching the new name, unless the feed has an explicit
+// directory.
+func renameFeed(oldName, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if err := validateFeedName(newName); err != nil {
+		return err
+	}
+
+	feed, ok := Config.FeedByName(oldName)
+	if !ok {
+		return fmt.Errorf("feed %q not found", oldName)
+	}
+	if _, exists := Config.FeedByName(newName); exists {
+		return fmt.Errorf("feed named '%s' already exists", newName)
+	}
+
+	renamed := feed
+	renamed.Name = newName
+	feeds := make([]Feed, 0, len(Config.Feeds))
+	for _, other := range Config.Feeds {
+		if other.Name != oldName {
+			feeds = append(feeds, other)
+		}
+	}
+	if err := validateFeedLayout(append(feeds, renamed)); err != nil {
+		return err
 	}
+	oldDir, newDir := feed.dir(), renamed.dir()
 
-	Config.Feeds = append(Config.Feeds, Feed{Name: sanitizedName, URL: sanitizedURL})
+	moved := false
+	if oldDir != newDir {
+		if _, err := os.Lstat(newDir); err == nil {
+			return fmt.Errorf("directory %s already exists", newDir)
+		}
+		if err := os.Rename(oldDir, newDir); err == nil {
+			moved = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("move articles of feed %q: %w", oldName, err)
+		}
+	}
+
+	err := editConfig(func(cfg *ini.File) error {
+		if section := feedListSection(cfg, oldName); section != nil {
+			value := section.Key(oldName).Value()
+			section.DeleteKey(oldName)
+			if _, err := section.NewKey(newName, value); err != nil {
+				return err
+			}
+		}
+		if oldSection, err := cfg.GetSection(feedSectionName(oldName)); err == nil {
+			newSection, err := cfg.NewSection(feedSectionName(newName))
+			if err != nil {
+				return err
+			}
+			for _, key := range oldSection.Keys() {
+				if _, err := newSection.NewKey(key.Name(), key.Value()); err != nil {
+					return err
+				}
+			}
+			cfg.DeleteSection(feedSectionName(oldName))
+		}
+		return nil
+	})
+	if err != nil {
+		if moved {
+			os.Rename(newDir, oldDir)
+		}
+		return err
+	}
+
+	if moved {
+		retargetNewLinks(oldDir, newDir)
+	}
+
+	for i := range Config.Feeds {
+		if Config.Feeds[i].Name == oldName {
+			Config.Feeds[i] = renamed
+			break
+		}
+	}
 
 	return nil
 }
 
+// setFeedURL changes the URL of a feed. Cached validators are dropped so the
+// next update downloads the new feed in full.
+func setFeedURL(name, url string) error {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return errors.New("feed URL cannot be empty")
+	}
+
+	feed, ok := Config.FeedByName(name)
+	if !ok {
+		return fmt.Errorf("feed %q not found", name)
+	}
+
+	err := editConfig(func(cfg *ini.File) error {
+		if section := feedListSection(cfg, name); section != nil {
+			section.Key(name).SetValue(url)
+		}
+		if section, err := cfg.GetSection(feedSectionName(name)); err == nil && section.HasKey("url") {
+			section.Key("url").SetValue(url)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if state, err := loadFeedState(feed.dir()); err == nil && (state.ETag != "" || state.LastModified != "") {
+		state.ETag = ""
+		state.LastModified = ""
+		if err := state.save(feed.dir()); err != nil {
+			log.WithError(err).Warnf("Failed to reset cached validators of feed '%s'", name)
+		}
+	}
+
+	for i := range Config.Feeds {
+		if Config.Feeds[i].Name == name {
+			Config.Feeds[i].URL = url
+			break
+		}
+	}
+
+	return nil
+}
+
+var summaryFormatFlag = &cli.StringFlag{
+	Name:  "format",
+	Value: "text",
+	Usage: "format of the summary printed after updating, text or json",
+}
+
+// runUpdate updates the feeds named on the command line, or all feeds, and
+// prints a summary of the results.
+func runUpdate(cCtx *cli.Context, deleteFiles bool) error {
+	format := cCtx.String("format")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown summary format %q: expected text or json", format)
+	}
+
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		return err
+	}
+
+	var results []FeedUpdateResult
+	if cCtx.Args().Len() == 0 {
+		results = UpdateAllFeeds(deleteFiles)
+	} else {
+		results = UpdateFeeds(Config.resolveFeedNames(cCtx.Args().Slice()), deleteFiles)
+	}
+
+	summary := summariseUpdate(results)
+	if err := writeUpdateSummary(os.Stdout, summary, format); err != nil {
+		return err
+	}
+	return updateExitError(summary)
+}
+
 func main() {
 	setUmask(0)
 	if err := LoadConfig(); err != nil {
@@ -60,6 +296,8 @@ func main() {
 	}
 
 	app := &cli.App{
+		// Errors are logged and turned into exit codes below.
+		ExitErrHandler: func(*cli.Context, error) {},
 		Commands: []*cli.Command{
 			{
 				Name:    "config",
@@ -83,53 +321,34 @@ func main() {
 			{
 				Name:    "refetch",
 				Aliases: []string{"r"},
-				Usage:   "delete and refetch given feed(s) or all feeds if no argument is given",
+				Usage:   "delete and refetch given feed(s) or categories, or all feeds if no argument is given",
+				Flags:   []cli.Flag{summaryFormatFlag},
 				Action: func(cCtx *cli.Context) error {
-					if err := InitialiseNewArticleDirectory(); err != nil {
-						return err
-					}
-					if cCtx.Args().Len() == 0 {
-						UpdateAllFeeds(true)
-						return nil
-					}
-					for i := 0; i < cCtx.Args().Len(); i++ {
-						name := cCtx.Args().Get(i)
-						if _, err := UpdateFeed(name, true); err != nil {
-							log.Error(err)
-						}
-					}
-					return nil
+					return runUpdate(cCtx, true)
 				},
 			},
 			{
 				Name:    "update",
 				Aliases: []string{"u"},
-				Usage:   "update given feed(s) or all feeds if no argument is given",
+				Usage:   "update given feed(s) or categories, or all feeds if no argument is given",
+				Flags:   []cli.Flag{summaryFormatFlag},
 				Action: func(cCtx *cli.Context) error {
-					if err := InitialiseNewArticleDirectory(); err != nil {
-						return err
-					}
-					if cCtx.Args().Len() == 0 {
-						UpdateAllFeeds(false)
-						return nil
-					}
-					for i := 0; i < cCtx.Args().Len(); i++ {
-						name := cCtx.Args().Get(i)
-						if _, err := UpdateFeed(name, false); err != nil {
-							log.Error(err)
-						}
-					}
-					return nil
+					return runUpdate(cCtx, false)
 				},
 			},
 			{
 				Name:    "open",
 				Aliases: []string{"o"},
-				Usage:   "open given feed's directory or root feeds directory if no argument is given",
+				Usage:   "open given feed's or category's directory or root feeds directory if no argument is given",
 				Action: func(cCtx *cli.Context) error {
 					path := Config.FeedDirectory
 					if cCtx.Args().Len() > 0 {
-						path = filepath.Join(Config.FeedDirectory, cCtx.Args().Get(0))
+						name := cCtx.Args().Get(0)
+						if feed, ok := Config.FeedByName(name); ok {
+							path = feed.dir()
+						} else {
+							path = filepath.Join(Config.FeedDirectory, filepath.FromSlash(name))
+						}
 					}
 					cmd := exec.Command(Config.Viewer, path)
 					cmd.Stdin = os.Stdin
@@ -138,20 +357,195 @@ func main() {
 				},
 			},
 			{
-				Name:    "add",
-				Aliases: []string{"a"},
-				Usage:   "add a given feed to config",
+				Name:      "add",
+				Aliases:   []string{"a"},
+				Usage:     "add a given feed to config, discovering the feeds of a web page",
+				ArgsUsage: "[feed name] <URL>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "category",
+						Aliases: []string{"c"},
+						Usage:   "category the feed belongs to, e.g. Tech or Tech/Go",
+					},
+					&cli.IntFlag{
+						Name:  "pick",
+						Usage: "add the `N`th feed found on a web page instead of prompting",
+					},
+					&cli.BoolFlag{
+						Name:  "no-verify",
+						Usage: "add the URL as given without fetching and parsing it",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					var name, url string
+					switch cCtx.Args().Len() {
+					case 1:
+						url = cCtx.Args().Get(0)
+					case 2:
+						name, url = cCtx.Args().Get(0), cCtx.Args().Get(1)
+					default:
+						return errors.New("one or two arguments are required: an optional feed name followed by the URL")
+					}
+					if strings.TrimSpace(url) == "" {
+						return errors.New("feed URL cannot be empty")
+					}
+
+					if cCtx.Bool("no-verify") {
+						if strings.TrimSpace(name) == "" {
+							return errors.New("a feed name is required with --no-verify")
+						}
+						return addFeed(name, url, cCtx.String("category"))
+					}
+
+					interactive := false
+					if info, err := os.Stdin.Stat(); err == nil {
+						interactive = info.Mode()&os.ModeCharDevice != 0
+					}
+					feedURL, feed, err := resolveFeed(strings.TrimSpace(url), func(candidates []feedCandidate) (int, error) {
+						return chooseCandidate(candidates, cCtx.Int("pick"), interactive, os.Stdin, os.Stdout)
+					})
+					if err != nil {
+						return fmt.Errorf("%w (use --no-verify to add it anyway)", err)
+					}
+
+					if strings.TrimSpace(name) == "" {
+						if name = suggestFeedName(feed, feedURL); name == "" {
+							return errors.New("unable to suggest a feed name - give one before the URL")
+						}
+					}
+					if err := addFeed(name, feedURL, cCtx.String("category")); err != nil {
+						return err
+					}
+					log.Infof("Added feed '%s' (%s)", strings.TrimSpace(name), feedURL)
+					return nil
+				},
+			},
+			{
+				Name:      "check",
+				Usage:     "fetch and parse all feeds, or the given feed(s) or categories, and report dead or stale ones",
+				ArgsUsage: "[feed name]...",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print the results as JSON",
+					},
+					&cli.StringFlag{
+						Name:  "stale-after",
+						Usage: "flag feeds whose newest item is older than this, e.g. 90d",
+						Value: "180d",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					staleAfter, err := parseDuration(cCtx.String("stale-after"))
+					if err != nil {
+						return fmt.Errorf("invalid --stale-after: %w", err)
+					}
+					var names []string
+					if cCtx.Args().Len() > 0 {
+						names = Config.resolveFeedNames(cCtx.Args().Slice())
+					} else {
+						for _, feed := range Config.Feeds {
+							names = append(names, feed.Name)
+						}
+					}
+
+					checks := checkFeeds(names, staleAfter)
+					if cCtx.Bool("json") {
+						err = writeFeedChecksJSON(os.Stdout, checks)
+					} else {
+						err = writeFeedChecksTable(os.Stdout, checks)
+					}
+					if err != nil {
+						return err
+					}
+					return checkExitError(checks)
+				},
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"l", "ls"},
+				Usage:     "list feeds with their status, or only the given feed(s) or categories",
+				ArgsUsage: "[feed name]...",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print the list as JSON",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					feeds := Config.Feeds
+					if cCtx.Args().Len() > 0 {
+						feeds = nil
+						for _, name := range Config.resolveFeedNames(cCtx.Args().Slice()) {
+							feed, ok := Config.FeedByName(name)
+							if !ok {
+								return fmt.Errorf("feed %q not found", name)
+							}
+							feeds = append(feeds, feed)
+						}
+					}
+					statuses := make([]feedStatus, 0, len(feeds))
+					for _, feed := range feeds {
+						statuses = append(statuses, collectFeedStatus(feed))
+					}
+					if cCtx.Bool("json") {
+						return writeFeedStatusJSON(os.Stdout, statuses)
+					}
+					return writeFeedStatusTable(os.Stdout, statuses)
+				},
+			},
+			{
+				Name:      "remove",
+				Aliases:   []string{"rm"},
+				Usage:     "remove a given feed from config",
+				ArgsUsage: "<feed name>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "delete-files",
+						Aliases: []string{"d"},
+						Usage:   "also delete the feed's downloaded articles",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.Args().Len() != 1 {
+						return errors.New("exactly one argument specifying the feed name is required")
+					}
+					return removeFeed(cCtx.Args().Get(0), cCtx.Bool("delete-files"))
+				},
+			},
+			{
+				Name:      "rename",
+				Usage:     "rename a given feed and move its articles",
+				ArgsUsage: "<old name> <new name>",
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.Args().Len() != 2 {
+						return errors.New("exactly two arguments are required, first being current feed name, second being new name")
+					}
+					return renameFeed(cCtx.Args().Get(0), cCtx.Args().Get(1))
+				},
+			},
+			{
+				Name:      "set-url",
+				Usage:     "change the URL of a given feed",
+				ArgsUsage: "<feed name> <feed url>",
 				Action: func(cCtx *cli.Context) error {
 					if cCtx.Args().Len() != 2 {
 						return errors.New("exactly two arguments are required, first being feed name, second being URL")
 					}
-					return addFeed(cCtx.Args().Get(0), cCtx.Args().Get(1))
+					return setFeedURL(cCtx.Args().Get(0), cCtx.Args().Get(1))
 				},
 			},
 			{
-				Name:    "import",
-				Aliases: []string{"i"},
-				Usage:   "import an OPML file",
+				Name:      "import",
+				Aliases:   []string{"i"},
+				Usage:     "import an OPML file",
+				ArgsUsage: "<OPML file path or URL>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print the feeds that would be added without changing the config",
+					},
+				},
 				Action: func(cCtx *cli.Context) error {
 					if cCtx.Args().Len() != 1 {
 						return errors.New("argument specifying OPML file path or URL is required")
@@ -163,37 +557,93 @@ func main() {
 							return err
 						}
 					}
-					for _, outline := range doc.Body.Outlines {
-						if len(outline.XMLURL) > 0 {
-							var title string
-							if len(outline.Title) > 0 {
-								title = outline.Title
-							} else if len(outline.Text) > 0 {
-								title = outline.Text
+					planned, err := planImport(doc.Body.Outlines, Config.Feeds)
+					if err != nil {
+						return err
+					}
+					if cCtx.Bool("dry-run") {
+						for _, feed := range planned {
+							if feed.Category != "" {
+								fmt.Printf("%s = %s (category %s)\n", feed.Name, feed.URL, feed.Category)
 							} else {
-								continue
-							}
-							if err := addFeed(strings.ReplaceAll(title, " ", "-"), outline.XMLURL); err != nil {
-								log.Errorf("Failed to add feed titled '%s': %v", title, err)
-								continue
+								fmt.Printf("%s = %s\n", feed.Name, feed.URL)
 							}
 						}
-						for _, innerOutline := range outline.Outlines {
-							if len(innerOutline.XMLURL) > 0 {
-								var title string
-								if len(innerOutline.Title) > 0 {
-									title = innerOutline.Title
-								} else if len(innerOutline.Text) > 0 {
-									title = innerOutline.Text
-								} else {
-									continue
-								}
-								if err := addFeed(strings.ReplaceAll(title, " ", "-"), innerOutline.XMLURL); err != nil {
-									log.Errorf("Failed to add feed titled '%s': %v", title, err)
-									continue
-								}
-							}
+						log.Infof("%d feeds would be imported", len(planned))
+						return nil
+					}
+					imported := 0
+					for _, feed := range planned {
+						if err := addFeed(feed.Name, feed.URL, feed.Category); err != nil {
+							log.Errorf("Failed to add feed '%s': %v", feed.Name, err)
+							continue
+						}
+						imported++
+					}
+					log.Infof("%d feeds imported", imported)
+					return nil
+				},
+			},
+			{
+				Name:      "export",
+				Aliases:   []string{"e"},
+				Usage:     "export all feeds as an OPML file, or to standard output if no file is given",
+				ArgsUsage: "[file]",
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.Args().Len() > 1 {
+						return errors.New("at most one argument specifying the OPML file path is allowed")
+					}
+					doc := buildOPML(Config.Feeds)
+					path := cCtx.Args().First()
+					if path == "" || path == "-" {
+						return writeOPML(os.Stdout, doc)
+					}
+					file, err := os.Create(path)
+					if err != nil {
+						return fmt.Errorf("create OPML file: %w", err)
+					}
+					if err := writeOPML(file, doc); err != nil {
+						file.Close()
+						return err
+					}
+					return file.Close()
+				},
+			},
+			{
+				Name:      "export-mbox",
+				Usage:     "export the downloaded articles of given feed(s) or categories as one mbox file per feed",
+				ArgsUsage: "<feed name>...",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output-dir",
+						Aliases: []string{"o"},
+						Value:   ".",
+						Usage:   "directory the mbox files are written to",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.Args().Len() == 0 {
+						return errors.New("at least one feed name is required")
+					}
+					var feeds []Feed
+					for _, name := range Config.resolveFeedNames(cCtx.Args().Slice()) {
+						feed, ok := Config.FeedByName(name)
+						if !ok {
+							return fmt.Errorf("feed %q not found", name)
+						}
+						feeds = append(feeds, feed)
+					}
+					dir := cCtx.String("output-dir")
+					if err := os.MkdirAll(dir, 0o755); err != nil {
+						return fmt.Errorf("ensure output directory %q: %w", dir, err)
+					}
+					for _, feed := range feeds {
+						path := filepath.Join(dir, feed.Name+".mbox")
+						count, err := exportFeedMbox(feed, path)
+						if err != nil {
+							return fmt.Errorf("export feed %q: %w", feed.Name, err)
 						}
+						log.Infof("Exported %d articles from feed '%s' to %s", count, feed.Name, path)
 					}
 					return nil
 				},
@@ -212,5 +662,10 @@ func main() {
 
 	if err := app.Run(os.Args); err != nil {
 		log.Error(err)
+		var exitErr cli.ExitCoder
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		os.Exit(exitError)
 	}
 }
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// renderMarkdown writes the item as Markdown converted from its HTML, with
+// the item's metadata in YAML front matter.
+func renderMarkdown(a *article) ([]byte, error) {
+	item := a.Item
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	writeYAMLField(&b, "title", item.Title)
+	writeYAMLField(&b, "feed", a.Feed.Name)
+	writeYAMLField(&b, "link", item.Link)
+	writeYAMLField(&b, "author", itemAuthor(item))
+	if item.PublishedParsed != nil {
+		b.WriteString("published: " + item.PublishedParsed.Format(time.RFC3339) + "\n")
+	} else {
+		writeYAMLField(&b, "published", item.Published)
+	}
+	if item.UpdatedParsed != nil {
+		b.WriteString("updated: " + item.UpdatedParsed.Format(time.RFC3339) + "\n")
+	}
+	writeYAMLField(&b, "guid", item.GUID)
+	if len(item.Categories) > 0 {
+		b.WriteString("categories:\n")
+		for _, category := range item.Categories {
+			b.WriteString("  - " + yamlQuote(category) + "\n")
+		}
+	}
+	if len(item.Enclosures) > 0 {
+		b.WriteString("enclosures:\n")
+		for _, enclosure := range item.Enclosures {
+			b.WriteString("  - url: " + yamlQuote(enclosure.URL) + "\n")
+			if enclosure.Type != "" {
+				b.WriteString("    type: " + yamlQuote(enclosure.Type) + "\n")
+			}
+			if length, err := strconv.ParseInt(enclosure.Length, 10, 64); err == nil && length > 0 {
+				b.WriteString("    length: " + strconv.FormatInt(length, 10) + "\n")
+			}
+		}
+	}
+	b.WriteString("---\n")
+
+	body := item.Content
+	if strings.TrimSpace(body) == "" {
+		body = item.Description
+	}
+	if markdown := htmlToMarkdown(body, item.Link); markdown != "" {
+		b.WriteString("\n" + markdown + "\n")
+	}
+
+	return []byte(b.String()), nil
+}
+
+func writeYAMLField(b *strings.Builder, key, value string) {
+	if value == "" {
+		return
+	}
+	b.WriteString(key + ": " + yamlQuote(value) + "\n")
+}
+
+// yamlQuote returns value as a double-quoted YAML scalar. The escapes
+// produced by strconv.Quote are a subset of those YAML understands.
+func yamlQuote(value string) string {
+	return strconv.Quote(value)
+}
+
+// itemAuthor returns the first author of the item as "Name <email>".
+func itemAuthor(item *gofeed.Item) string {
+	person := item.Author
+	if len(item.Authors) > 0 {
+		person = item.Authors[0]
+	}
+	if person == nil {
+		return ""
+	}
+	switch {
+	case person.Name != "" && person.Email != "":
+		return person.Name + " <" + person.Email + ">"
+	case person.Name != "":
+		return person.Name
+	default:
+		return person.Email
+	}
+}
+
+// parseHTMLFragment parses s as the contents of a <body> element.
+func parseHTMLFragment(s string) ([]*html.Node, error) {
+	return html.ParseFragment(strings.NewReader(s), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+}
+
+// htmlToMarkdown converts an HTML fragment to Markdown, resolving relative
+// links against base. Input without any markup is returned as plain text.
+func htmlToMarkdown(s, base string) string {
+	if !strings.Contains(s, "<") {
+		lines := strings.Split(strings.TrimSpace(html.UnescapeString(s)), "\n")
+		for i, line := range lines {
+			lines[i] = escapeLineStart(escapeMarkdown(strings.TrimSpace(line)))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	nodes, err := parseHTMLFragment(s)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+
+	r := &markdownRenderer{}
+	if parsed, err := url.Parse(base); err == nil {
+		r.base = parsed
+	}
+	for _, node := range nodes {
+		r.render(node)
+	}
+	return tidyMarkdown(r.out.String())
+}
+
+type markdownRenderer struct {
+	out  strings.Builder
+	base *url.URL
+}
+
+// fragment renders the children of n with a fresh renderer and returns the
+// tidied result.
+func (r *markdownRenderer) fragment(n *html.Node) string {
+	sub := &markdownRenderer{base: r.base}
+	sub.renderChildren(n)
+	return tidyMarkdown(sub.out.String())
+}
+
+// inline renders the children of n on a single line.
+func (r *markdownRenderer) inline(n *html.Node) string {
+	return strings.Join(strings.Fields(r.fragment(n)), " ")
+}
+
+func (r *markdownRenderer) atLineStart() bool {
+	s := r.out.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+func (r *markdownRenderer) blankLine() {
+	s := r.out.String()
+	if s == "" {
+		return
+	}
+	for n := len(s) - len(strings.TrimRight(s, "\n")); n < 2; n++ {
+		r.out.WriteByte('\n')
+	}
+}
+
+func (r *markdownRenderer) text(s string) {
+	s = escapeMarkdown(collapseWhitespace(s))
+	if r.atLineStart() {
+		s = escapeLineStart(strings.TrimLeft(s, " "))
+	}
+	r.out.WriteString(s)
+}
+
+// block writes s as a paragraph-level block, separated by blank lines.
+func (r *markdownRenderer) block(s string) {
+	if s == "" {
+		return
+	}
+	r.blankLine()
+	r.out.WriteString(s)
+	r.blankLine()
+}
+
+func (r *markdownRenderer) renderChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
+
+func (r *markdownRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.renderChildren(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Iframe, atom.Head, atom.Template:
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		if text := r.inline(n); text != "" {
+			r.block(strings.Repeat("#", level) + " " + text)
+		}
+	case atom.Br:
+		r.out.WriteString("\\\n")
+	case atom.Hr:
+		r.block("---")
+	case atom.Pre:
+		r.block(codeFence(textContent(n), codeLanguage(n)))
+	case atom.Blockquote:
+		r.block(prefixLines(r.fragment(n), "> "))
+	case atom.Ul, atom.Ol:
+		r.block(r.list(n))
+	case atom.Table:
+		r.block(r.table(n))
+	case atom.A:
+		r.link(n)
+	case atom.Img:
+		if src := r.resolve(attr(n, "src")); src != "" {
+			r.out.WriteString("![" + escapeMarkdown(attr(n, "alt")) + "](" + src + ")")
+		}
+	case atom.Strong, atom.B:
+		r.emphasis(n, "**")
+	case atom.Em, atom.I:
+		r.emphasis(n, "*")
+	case atom.Del, atom.S, atom.Strike:
+		r.emphasis(n, "~~")
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		r.out.WriteString(inlineCode(textContent(n)))
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main,
+		atom.Aside, atom.Nav, atom.Figure, atom.Figcaption, atom.Dl, atom.Dt, atom.Dd, atom.Details, atom.Summary:
+		r.block(r.fragment(n))
+	default:
+		r.renderChildren(n)
+	}
+}
+
+func (r *markdownRenderer) link(n *html.Node) {
+	text := r.inline(n)
+	href := r.resolve(attr(n, "href"))
+	switch {
+	case href == "":
+		r.out.WriteString(text)
+	case text == "":
+		r.out.WriteString("<" + href + ">")
+	default:
+		r.out.WriteString("[" + text + "](" + href + ")")
+	}
+}
+
+func (r *markdownRenderer) emphasis(n *html.Node, marker string) {
+	text := r.inline(n)
+	if text == "" {
+		return
+	}
+	if !r.atLineStart() && startsWithSpace(n) {
+		r.out.WriteByte(' ')
+	}
+	r.out.WriteString(marker + text + marker)
+	if endsWithSpace(n) {
+		r.out.WriteByte(' ')
+	}
+}
+
+func (r *markdownRenderer) list(n *html.Node) string {
+	ordered := n.DataAtom == atom.Ol
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = start
+	}
+
+	var items []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		content := r.fragment(c)
+		indented := prefixLines(content, strings.Repeat(" ", len(marker)))
+		items = append(items, marker+strings.TrimLeft(indented, " "))
+	}
+	return strings.Join(items, "\n")
+}
+
+func (r *markdownRenderer) table(n *html.Node) string {
+	var rows []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.DataAtom != atom.Tr {
+				walk(c)
+				continue
+			}
+			var cells []string
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					cells = append(cells, strings.ReplaceAll(r.inline(cell), "|", "\\|"))
+				}
+			}
+			if len(cells) == 0 {
+				continue
+			}
+			rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+			if len(rows) == 1 {
+				rows = append(rows, "|"+strings.Repeat(" --- |", len(cells)))
+			}
+		}
+	}
+	walk(n)
+	return strings.Join(rows, "\n")
+}
+
+// resolve returns ref resolved against the article link, dropping
+// javascript: URLs.
+func (r *markdownRenderer) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(strings.ToLower(ref), "javascript:") {
+		return ""
+	}
+	if r.base == nil {
+		return ref
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return r.base.ResolveReference(parsed).String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Br {
+			b.WriteByte('\n')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func startsWithSpace(n *html.Node) bool {
+	text := textContent(n)
+	return text != strings.TrimLeft(text, " \t\r\n")
+}
+
+func endsWithSpace(n *html.Node) bool {
+	text := textContent(n)
+	return text != strings.TrimRight(text, " \t\r\n")
+}
+
+// codeLanguage returns the language of a code block marked up as
+// <pre><code class="language-go">.
+func codeLanguage(n *html.Node) string {
+	for _, node := range []*html.Node{n, n.FirstChild} {
+		if node == nil || node.Type != html.ElementNode {
+			continue
+		}
+		for _, class := range strings.Fields(attr(node, "class")) {
+			if strings.HasPrefix(class, "language-") {
+				return strings.TrimPrefix(class, "language-")
+			}
+		}
+	}
+	return ""
+}
+
+func codeFence(code, language string) string {
+	fence := "```"
+	if strings.Contains(code, fence) {
+		fence = "~~~"
+	}
+	return fence + language + "\n" + strings.Trim(code, "\n") + "\n" + fence
+}
+
+func inlineCode(code string) string {
+	code = collapseWhitespace(code)
+	if code == "" {
+		return ""
+	}
+	if strings.Contains(code, "`") {
+		return "`` " + code + " ``"
+	}
+	return "`" + code + "`"
+}
+
+func prefixLines(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = strings.TrimRight(prefix, " ")
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func collapseWhitespace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+)
+
+// markdownHTMLStart matches text that Markdown would read as the start of
+// an HTML tag, comment or autolink, or as an entity reference.
+var markdownHTMLStart = regexp.MustCompile(`<[A-Za-z/!?]|&#?[0-9A-Za-z]+;`)
+
+// markdownBlockStart matches text that would start a heading, quote, list
+// or thematic break at the beginning of a line, capturing the character
+// to escape.
+var markdownBlockStart = regexp.MustCompile(`^(?:(#{1,6})(?:\s|$)|(>)|([-+=])(?:[-=\s]|$)|\d{1,9}([.)])(?:\s|$))`)
+
+func escapeMarkdown(s string) string {
+	return markdownHTMLStart.ReplaceAllString(markdownEscaper.Replace(s), `\$0`)
+}
+
+// escapeLineStart escapes a block marker at the start of s, which is about
+// to be written at the beginning of a line.
+func escapeLineStart(s string) string {
+	match := markdownBlockStart.FindStringSubmatchIndex(s)
+	if match == nil {
+		return s
+	}
+	for i := len(match) - 2; i >= 2; i -= 2 {
+		if match[i] >= 0 {
+			return s[:match[i]] + `\` + s[match[i]:]
+		}
+	}
+	return s
+}
+
+// tidyMarkdown strips trailing whitespace from every line and collapses runs
+// of blank lines.
+func tidyMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Plain &amp; simple", "Plain & simple"},
+		{"<h2>Heading</h2><p>Some <strong>bold</strong> and <em>italic</em> text.</p>", "## Heading\n\nSome **bold** and *italic* text."},
+		{`<p>See <a href="/post">this post</a> and <a href="https://other.example/">that one</a>.</p>`, "See [this post](https://example.com/post) and [that one](https://other.example/)."},
+		{"<ul><li>one</li><li>two</li></ul>", "- one\n- two"},
+		{`<ol start="3"><li>three</li><li>four</li></ol>`, "3. three\n4. four"},
+		{`<pre><code class="language-go">x := 1` + "\n" + `</code></pre>`, "```go\nx := 1\n```"},
+		{"<p>Use <code>go test</code> to run</p>", "Use `go test` to run"},
+		{"<blockquote><p>quoted</p></blockquote>", "> quoted"},
+		{`<p><img src="img.png" alt="An image"></p>`, "![An image](https://example.com/img.png)"},
+		{"<p>a_b *c*</p><script>alert(1)</script>", `a\_b \*c\*`},
+		{"<p>&lt;details&gt; &amp;amp; a &lt; b &amp; c</p>", `\<details> \&amp; a < b & c`},
+		{"&lt;script&gt;alert(1)&lt;/script&gt;", `\<script>alert(1)\</script>`},
+		{"<p>1. not a list # heading?</p><p># Not a heading</p><p>- not an item</p><p>&gt; not a quote</p><p>-5 degrees</p>",
+			"1\\. not a list # heading?\n\n\\# Not a heading\n\n\\- not an item\n\n\\> not a quote\n\n-5 degrees"},
+		{"<p>line<br>2) second<br>=== rule</p>", "line\\\n2\\) second\\\n\\=== rule"},
+	}
+
+	for _, tc := range tests {
+		if got := htmlToMarkdown(tc.input, "https://example.com/article"); got != tc.want {
+			t.Errorf("htmlToMarkdown(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	published := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	item := &gofeed.Item{
+		Title:           `A "quoted" title`,
+		Link:            "https://example.com/article",
+		Description:     "Summary",
+		Content:         "<p>Body</p>",
+		PublishedParsed: &published,
+		Author:          &gofeed.Person{Name: "Jane", Email: "jane@example.com"},
+		GUID:            "guid-1",
+		Categories:      []string{"go"},
+		Enclosures:      []*gofeed.Enclosure{{URL: "https://example.com/a.mp3", Type: "audio/mpeg", Length: "123"}},
+	}
+
+	content, err := renderMarkdown(&article{Feed: Feed{Name: "test-feed"}, Item: item})
+	if err != nil {
+		t.Fatalf("renderMarkdown returned error: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"---",
+		`title: "A \"quoted\" title"`,
+		`feed: "test-feed"`,
+		`link: "https://example.com/article"`,
+		`author: "Jane <jane@example.com>"`,
+		"published: 2006-01-02T15:04:05Z",
+		`guid: "guid-1"`,
+		"categories:",
+		`  - "go"`,
+		"enclosures:",
+		`  - url: "https://example.com/a.mp3"`,
+		`    type: "audio/mpeg"`,
+		"    length: 123",
+		"---",
+		"",
+		"Body",
+		"",
+	}, "\n")
+	if string(content) != want {
+		t.Fatalf("unexpected Markdown:\n%s\nwant:\n%s", content, want)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// mboxFromLine matches body lines that have to be quoted in the mboxrd
+// format.
+var mboxFromLine = regexp.MustCompile(`^>*From `)
+
+// exportFeedMbox writes the stored articles of a feed, oldest first, to an
+// mbox file at path and returns the number of articles written.
+func exportFeedMbox(feed Feed, path string) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("create mbox file: %w", err)
+	}
+	count, err := writeFeedMbox(file, feed)
+	if err != nil {
+		file.Close()
+		return count, err
+	}
+	return count, file.Close()
+}
+
+func writeFeedMbox(w io.Writer, feed Feed) (int, error) {
+	state, err := loadFeedState(feed.dir())
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(state.Items))
+	for key, seen := range state.Items {
+		if seen.File != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		di, dj := state.Items[keys[i]].date(), state.Items[keys[j]].date()
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return keys[i] < keys[j]
+	})
+
+	out := bufio.NewWriter(w)
+	count := 0
+	for _, key := range keys {
+		seen := state.Items[key]
+		message, err := mboxMessage(feed, key, seen)
+		if err != nil {
+			log.WithError(err).Warnf("Skipping article %s of feed '%s'", seen.File, feed.Name)
+			continue
+		}
+		if err := writeMboxMessage(out, "rssnix@"+mailHost(feed), seen.date(), message); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, out.Flush()
+}
+
+// mboxMessage returns a stored article as a mail message. Articles delivered
+// to a Maildir folder already are one; other articles are wrapped in a
+// message carrying the metadata from the feed's index.
+func mboxMessage(feed Feed, key string, seen *seenItem) ([]byte, error) {
+	if filepath.Dir(seen.File) == maildirNew {
+		path, err := findMaildirMessage(feed.dir(), seen.File)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(path)
+	}
+
+	content, err := os.ReadFile(filepath.Join(feed.dir(), seen.File))
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := "text/plain"
+	if filepath.Ext(seen.File) == articleFormats["html"].Extension {
+		contentType = "text/html"
+	}
+
+	host := mailHost(feed)
+	from := mail.Address{Name: feed.Name, Address: "rssnix@" + host}
+
+	var b strings.Builder
+	writeMailHeader(&b, "From", from.String())
+	writeMailHeader(&b, "Date", seen.date().Format(time.RFC1123Z))
+	writeMailHeader(&b, "Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(seen.Title)))
+	writeMailHeader(&b, "Message-ID", messageID(key, host))
+	writeMailHeader(&b, "X-RSS-Feed", mime.QEncoding.Encode("utf-8", feed.Name))
+	writeMailHeader(&b, "X-RSS-Link", seen.Link)
+	writeMailHeader(&b, "MIME-Version", "1.0")
+	writeMailHeader(&b, "Content-Type", contentType+"; charset=utf-8")
+	writeMailHeader(&b, "Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	if _, err := qp.Write(bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(b.String()), body.Bytes()...), nil
+}
+
+// writeMboxMessage appends message to an mbox in the mboxrd format, with
+// line endings converted to LF and lines starting with "From " quoted.
+func writeMboxMessage(w *bufio.Writer, sender string, date time.Time, message []byte) error {
+	if _, err := fmt.Fprintf(w, "From %s %s\n", sender, date.UTC().Format(time.ANSIC)); err != nil {
+		return err
+	}
+
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	lines := strings.Split(strings.TrimRight(string(message), "\n"), "\n")
+	for _, line := range lines {
+		if mboxFromLine.MatchString(line) {
+			line = ">" + line
+		}
+		if _, err := w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
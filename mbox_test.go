@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMboxMessage(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	date := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	message := "Subject: test\r\n\r\nFrom here\r\n>From there\r\nFromage\r\n"
+	if err := writeMboxMessage(w, "rssnix@example.com", date, []byte(message)); err != nil {
+		t.Fatalf("writeMboxMessage returned error: %v", err)
+	}
+	w.Flush()
+
+	want := "From rssnix@example.com Mon Jan  2 15:04:05 2006\nSubject: test\n\n>From here\n>>From there\nFromage\n\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected mbox:\n%q\nwant:\n%q", buf.String(), want)
+	}
+}
+
+func TestExportFeedMbox(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<rss version="2.0"><channel><title>Test Feed</title>` +
+			`<item><title>Second</title><guid>2</guid><link>https://example.com/2</link><pubDate>Tue, 03 Jan 2006 15:04:05 GMT</pubDate><description>&lt;p&gt;two&lt;/p&gt;</description></item>` +
+			`<item><title>First</title><guid>1</guid><link>https://example.com/1</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate><description>one</description></item>` +
+			`</channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{
+		{Name: "html-feed", URL: server.URL, FeedOptions: FeedOptions{Format: "html"}},
+		{Name: "mail-feed", URL: server.URL, FeedOptions: FeedOptions{Format: "maildir"}},
+	}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+
+	for _, feed := range Config.Feeds {
+		if _, err := UpdateFeed(feed.Name, false); err != nil {
+			t.Fatalf("UpdateFeed returned error: %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), feed.Name+".mbox")
+		count, err := exportFeedMbox(feed, path)
+		if err != nil || count != 2 {
+			t.Fatalf("expected 2 exported articles, got %d (%v)", count, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile returned error: %v", err)
+		}
+		mbox := string(data)
+		if strings.Count(mbox, "\nFrom rssnix@") != 1 || !strings.HasPrefix(mbox, "From rssnix@127.0.0.1 Mon Jan  2 15:04:05 2006\n") {
+			t.Fatalf("expected two messages, oldest first:\n%s", mbox)
+		}
+		first, second := strings.Index(mbox, "Subject: First"), strings.Index(mbox, "Subject: Second")
+		if first < 0 || second < first {
+			t.Fatalf("expected messages ordered by date:\n%s", mbox)
+		}
+		if !strings.Contains(mbox, "X-RSS-Link: https://example.com/2") || !strings.Contains(mbox, "Message-ID: "+messageID("guid:2", "127.0.0.1")) {
+			t.Fatalf("expected metadata headers:\n%s", mbox)
+		}
+		if strings.Contains(mbox, "\r") {
+			t.Fatalf("expected LF line endings")
+		}
+	}
+}
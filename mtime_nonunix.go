@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+func setSymlinkTime(path string, t time.Time) error { return nil }
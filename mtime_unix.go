@@ -0,0 +1,16 @@
+//go:build unix
+
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSymlinkTime sets the access and modification times of the symlink at
+// path itself rather than of the file it points to.
+func setSymlinkTime(path string, t time.Time) error {
+	tv := unix.NsecToTimeval(t.UnixNano())
+	return unix.Lutimes(path, []unix.Timeval{tv, tv})
+}
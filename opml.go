@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gilliek/go-opml/opml"
+	log "github.com/sirupsen/logrus"
+)
+
+// buildOPML returns an OPML 2.0 document listing the given feeds, with
+// categories turned into nested folder outlines.
+func buildOPML(feeds []Feed) *opml.OPML {
+	doc := &opml.OPML{
+		Version: "2.0",
+		Head: opml.Head{
+			Title:       "rssnix subscriptions",
+			DateCreated: time.Now().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, feed := range feeds {
+		outline := opml.Outline{
+			Text:   feed.Name,
+			Title:  feed.Name,
+			Type:   "rss",
+			XMLURL: feed.URL,
+		}
+
+		state, err := loadFeedState(feed.dir())
+		if err != nil {
+			log.WithError(err).Warnf("Failed to read state of feed '%s'", feed.Name)
+		} else {
+			if state.Title != "" {
+				outline.Text = state.Title
+			}
+			outline.HTMLURL = state.SiteURL
+		}
+
+		outlines := &doc.Body.Outlines
+		if feed.Category != "" {
+			for _, folder := range strings.Split(feed.Category, "/") {
+				outlines = &folderOutline(outlines, folder).Outlines
+			}
+		}
+		*outlines = append(*outlines, outline)
+	}
+
+	return doc
+}
+
+// folderOutline returns the folder outline with the given name from
+// outlines, appending it first if there is none yet.
+func folderOutline(outlines *[]opml.Outline, name string) *opml.Outline {
+	for i := range *outlines {
+		if outline := &(*outlines)[i]; outline.XMLURL == "" && outline.Text == name {
+			return outline
+		}
+	}
+	*outlines = append(*outlines, opml.Outline{Text: name, Title: name})
+	return &(*outlines)[len(*outlines)-1]
+}
+
+func writeOPML(w io.Writer, doc *opml.OPML) error {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode OPML: %w", err)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// importedFeed is a feed found in an OPML document that is not configured
+// yet.
+type importedFeed struct {
+	Name     string
+	URL      string
+	Category string
+}
+
+// planImport walks outlines recursively and returns the feeds that are not
+// already configured, skipping any whose URL is known. Folder outlines become
+// categories and every feed is given a unique name derived from its title
+// that does not clash with a category. It fails if a folder clashes with a
+// configured feed.
+func planImport(outlines []opml.Outline, existing []Feed) ([]importedFeed, error) {
+	names := map[string]bool{}
+	urls := map[string]bool{}
+	categories := map[string]bool{}
+	for _, feed := range existing {
+		names[feed.Name] = true
+		urls[normaliseFeedURL(feed.URL)] = true
+		addCategoryPaths(categories, feed.Category)
+	}
+	var collect func(outlines []opml.Outline, category string)
+	collect = func(outlines []opml.Outline, category string) {
+		for _, outline := range outlines {
+			if strings.TrimSpace(outline.XMLURL) == "" {
+				folder := normaliseCategory(category + "/" + outlineTitle(outline))
+				addCategoryPaths(categories, folder)
+				collect(outline.Outlines, folder)
+			} else {
+				collect(outline.Outlines, category)
+			}
+		}
+	}
+	collect(outlines, "")
+	taken := func(name, category string) bool {
+		return names[name] || categories[path.Join(category, name)]
+	}
+
+	var planned []importedFeed
+	var walk func(outlines []opml.Outline, category string)
+	walk = func(outlines []opml.Outline, category string) {
+		for _, outline := range outlines {
+			title := outlineTitle(outline)
+
+			feedURL := strings.TrimSpace(outline.XMLURL)
+			if feedURL == "" {
+				walk(outline.Outlines, normaliseCategory(category+"/"+title))
+				continue
+			}
+
+			if urls[normaliseFeedURL(feedURL)] {
+				log.Debugf("Feed %s is already configured - skipping", feedURL)
+			} else {
+				name := uniqueFeedName(importFeedName(title, feedURL), func(name string) bool { return taken(name, category) })
+				names[name] = true
+				urls[normaliseFeedURL(feedURL)] = true
+				planned = append(planned, importedFeed{Name: name, URL: feedURL, Category: category})
+			}
+			walk(outline.Outlines, category)
+		}
+	}
+	walk(outlines, "")
+
+	feeds := append([]Feed{}, existing...)
+	for _, feed := range planned {
+		feeds = append(feeds, Feed{Name: feed.Name, URL: feed.URL, Category: feed.Category})
+	}
+	if err := validateFeedLayout(feeds); err != nil {
+		return nil, err
+	}
+	return planned, nil
+}
+
+// outlineTitle returns the title of an outline, or its text if it has none.
+func outlineTitle(outline opml.Outline) string {
+	if outline.Title != "" {
+		return outline.Title
+	}
+	return outline.Text
+}
+
+// addCategoryPaths adds category and every category it is nested in to
+// categories.
+func addCategoryPaths(categories map[string]bool, category string) {
+	for category != "" && category != "." {
+		categories[category] = true
+		category = path.Dir(category)
+	}
+}
+
+// normaliseFeedURL returns a form of a feed URL suitable for detecting
+// duplicates, ignoring the case of the scheme and host and a trailing slash.
+func normaliseFeedURL(raw string) string {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return strings.TrimSpace(raw)
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	return parsed.String()
+}
+
+// importFeedName turns an outline title into a feed name that is safe to
+// use both as a config key and as a directory name, falling back to the host
+// of the feed URL.
+func importFeedName(title, feedURL string) string {
+	name := strings.Trim(strings.ReplaceAll(cleanFeedName(title), " ", "-"), "-.")
+
+	if name == "" {
+		name = strings.TrimPrefix(feedHost(feedURL), "www.")
+	}
+	return truncateString(name, maxFileNameLength-8)
+}
+
+// uniqueFeedName returns name, or name with a numeric suffix, such that it is
+// not taken.
+func uniqueFeedName(name string, taken func(string) bool) string {
+	candidate := name
+	for n := 2; taken(candidate) || candidate == newArticleDirectory; n++ {
+		candidate = name + "-" + strconv.Itoa(n)
+	}
+	return candidate
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/gilliek/go-opml/opml"
+)
+
+func TestBuildOPMLNestsCategories(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	feeds := []Feed{
+		{Name: "Plain", URL: "https://example.com/plain"},
+		{Name: "HN", URL: "https://example.com/hn", Category: "Tech"},
+		{Name: "GoBlog", URL: "https://example.com/go", Category: "Tech/Go"},
+	}
+
+	state := newFeedState()
+	state.Title = "The Go Blog"
+	state.SiteURL = "https://go.dev/blog"
+	if err := os.MkdirAll(feeds[2].dir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.save(feeds[2].dir()); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeOPML(&buf, buildOPML(feeds)); err != nil {
+		t.Fatalf("writeOPML returned error: %v", err)
+	}
+
+	doc, err := opml.NewOPML(buf.Bytes())
+	if err != nil {
+		t.Fatalf("exported OPML does not parse: %v", err)
+	}
+	if doc.Version != "2.0" {
+		t.Fatalf("expected OPML 2.0, got %q", doc.Version)
+	}
+
+	outlines := doc.Body.Outlines
+	if len(outlines) != 2 || outlines[0].XMLURL != "https://example.com/plain" || outlines[1].Text != "Tech" {
+		t.Fatalf("unexpected top-level outlines: %+v", outlines)
+	}
+
+	tech := outlines[1].Outlines
+	if len(tech) != 2 || tech[0].Title != "HN" || tech[1].Text != "Go" {
+		t.Fatalf("unexpected Tech outlines: %+v", tech)
+	}
+
+	goBlog := tech[1].Outlines[0]
+	if goBlog.Title != "GoBlog" || goBlog.Text != "The Go Blog" || goBlog.HTMLURL != "https://go.dev/blog" || goBlog.Type != "rss" {
+		t.Fatalf("unexpected GoBlog outline: %+v", goBlog)
+	}
+}
+
+func TestPlanImportRecursesAndDedupes(t *testing.T) {
+	doc, err := opml.NewOPML([]byte(`<?xml version="1.0"?>
+<opml version="2.0"><head><title>Subscriptions</title></head><body>
+  <outline text="Top Feed" xmlUrl="https://example.com/top"/>
+  <outline text="Tech">
+    <outline text="Already There" xmlUrl="HTTPS://Example.com/existing/"/>
+    <outline text="Go">
+      <outline title="Go Blog" text="ignored" xmlUrl="https://go.dev/blog/feed.atom"/>
+      <outline text="Top Feed" xmlUrl="https://example.org/another-top"/>
+    </outline>
+  </outline>
+  <outline text="" xmlUrl="https://www.untitled.example/rss"/>
+  <outline text="Duplicate" xmlUrl="https://example.com/top"/>
+</body></opml>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing := []Feed{{Name: "existing", URL: "https://example.com/existing"}}
+	planned, err := planImport(doc.Body.Outlines, existing)
+	if err != nil {
+		t.Fatalf("planImport returned error: %v", err)
+	}
+
+	want := []importedFeed{
+		{Name: "Top-Feed", URL: "https://example.com/top"},
+		{Name: "Go-Blog", URL: "https://go.dev/blog/feed.atom", Category: "Tech/Go"},
+		{Name: "Top-Feed-2", URL: "https://example.org/another-top", Category: "Tech/Go"},
+		{Name: "untitled.example", URL: "https://www.untitled.example/rss"},
+	}
+	if len(planned) != len(want) {
+		t.Fatalf("expected %d feeds, got %+v", len(want), planned)
+	}
+	for i := range want {
+		if planned[i] != want[i] {
+			t.Errorf("feed %d: expected %+v, got %+v", i, want[i], planned[i])
+		}
+	}
+}
+
+func TestPlanImportAvoidsCategories(t *testing.T) {
+	doc, err := opml.NewOPML([]byte(`<?xml version="1.0"?>
+<opml version="2.0"><head><title>Subscriptions</title></head><body>
+  <outline text="Tech" xmlUrl="https://example.com/tech"/>
+  <outline text="Tech">
+    <outline text="Go" xmlUrl="https://go.dev/blog/feed.atom"/>
+  </outline>
+</body></opml>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	planned, err := planImport(doc.Body.Outlines, nil)
+	if err != nil {
+		t.Fatalf("planImport returned error: %v", err)
+	}
+	if len(planned) != 2 || planned[0].Name != "Tech-2" || planned[1].Category != "Tech" {
+		t.Fatalf("expected the feed not to take the name of the category, got %+v", planned)
+	}
+
+	existing := []Feed{{Name: "Tech", URL: "https://example.com/tech"}}
+	if _, err := planImport(doc.Body.Outlines[1:], existing); err == nil {
+		t.Fatal("expected a folder clashing with a configured feed to be rejected")
+	}
+}
+
+func TestImportFeedName(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Hacker News", "Hacker-News"},
+		{"a = b [c]", "a--b-c"},
+		{"  ../secret  ", "secret"},
+		{"", "example.com"},
+	}
+	for _, tc := range tests {
+		if got := importFeedName(tc.title, "https://www.example.com/feed"); got != tc.want {
+			t.Errorf("importFeedName(%q) = %q, want %q", tc.title, got, tc.want)
+		}
+	}
+}
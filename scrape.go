@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/go-ini/ini"
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	feedTypeFeed   = "feed"
+	feedTypeScrape = "scrape"
+
+	defaultScrapeTitle = "h1, h2, h3, h4, h5, h6"
+	defaultScrapeLink  = "a[href]"
+)
+
+// scrapeDateLayouts are tried in order to parse item dates when the feed
+// gives no scrape_date_format.
+var scrapeDateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	"02/01/2006",
+	"01/02/2006",
+	"2.1.2006",
+}
+
+// ScrapeOptions are the CSS selectors used to build items from a web page
+// that has no feed of its own. Every element matching Item becomes an item;
+// the other selectors are matched inside it.
+type ScrapeOptions struct {
+	Item       string
+	Title      string
+	Link       string
+	Date       string
+	DateFormat string
+	Body       string
+}
+
+// loadScrapeOptions returns the scrape settings of a feed section, or nil if
+// the feed is a regular feed.
+func loadScrapeOptions(section *ini.Section) (*ScrapeOptions, error) {
+	switch feedType := strings.TrimSpace(section.Key("type").String()); feedType {
+	case "", feedTypeFeed:
+		for _, key := range []string{"scrape_item", "scrape_title", "scrape_link", "scrape_date", "scrape_date_format", "scrape_body"} {
+			if section.HasKey(key) {
+				return nil, fmt.Errorf("%s requires type = %s", key, feedTypeScrape)
+			}
+		}
+		return nil, nil
+	case feedTypeScrape:
+	default:
+		return nil, fmt.Errorf("invalid type %q: expected %s or %s", feedType, feedTypeFeed, feedTypeScrape)
+	}
+
+	scrape := &ScrapeOptions{
+		Item:       strings.TrimSpace(section.Key("scrape_item").String()),
+		Title:      strings.TrimSpace(section.Key("scrape_title").String()),
+		Link:       strings.TrimSpace(section.Key("scrape_link").String()),
+		Date:       strings.TrimSpace(section.Key("scrape_date").String()),
+		DateFormat: strings.TrimSpace(section.Key("scrape_date_format").String()),
+		Body:       strings.TrimSpace(section.Key("scrape_body").String()),
+	}
+	if scrape.Item == "" {
+		return nil, fmt.Errorf("type = %s requires scrape_item", feedTypeScrape)
+	}
+	if scrape.Title == "" {
+		scrape.Title = defaultScrapeTitle
+	}
+	if scrape.Link == "" {
+		scrape.Link = defaultScrapeLink
+	}
+
+	for key, selector := range map[string]string{
+		"scrape_item":  scrape.Item,
+		"scrape_title": scrape.Title,
+		"scrape_link":  scrape.Link,
+		"scrape_date":  scrape.Date,
+		"scrape_body":  scrape.Body,
+	} {
+		if selector == "" {
+			continue
+		}
+		if _, err := cascadia.ParseGroup(selector); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", key, selector, err)
+		}
+	}
+	return scrape, nil
+}
+
+// scrapePage builds a feed from the HTML page in body, which was served from
+// pageURL. Relative links in the page are resolved against pageURL.
+func scrapePage(body io.Reader, pageURL *url.URL, scrape *ScrapeOptions) (*gofeed.Feed, error) {
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse page: %w", err)
+	}
+	doc.Url = pageURL
+
+	feed := &gofeed.Feed{
+		Title:    strings.TrimSpace(doc.Find("title").First().Text()),
+		Link:     pageURL.String(),
+		FeedType: feedTypeScrape,
+	}
+
+	containers := doc.Find(scrape.Item)
+	if containers.Length() == 0 {
+		return nil, fmt.Errorf("no elements match scrape_item %q", scrape.Item)
+	}
+	containers.Each(func(_ int, s *goquery.Selection) {
+		if item := scrapeItem(s, pageURL, scrape); item != nil {
+			feed.Items = append(feed.Items, item)
+		}
+	})
+	return feed, nil
+}
+
+// scrapeItem builds an item from one element matching scrape_item. It
+// returns nil if the element has neither a title nor a link.
+func scrapeItem(s *goquery.Selection, pageURL *url.URL, scrape *ScrapeOptions) *gofeed.Item {
+	item := &gofeed.Item{}
+
+	title := s.Find(scrape.Title).First()
+	item.Title = collapseWhitespace(strings.TrimSpace(title.Text()))
+
+	if href, ok := scrapeLink(s.Find(scrape.Link).First()); ok {
+		if resolved, err := pageURL.Parse(href); err == nil {
+			item.Link = resolved.String()
+		}
+	}
+	if item.Title == "" && item.Link == "" {
+		return nil
+	}
+
+	if scrape.Date != "" {
+		date := s.Find(scrape.Date).First()
+		raw := date.AttrOr("datetime", date.AttrOr("content", date.Text()))
+		raw = strings.TrimSpace(raw)
+		if parsed, ok := parseScrapedDate(raw, scrape.DateFormat); ok {
+			item.Published = raw
+			item.PublishedParsed = &parsed
+		}
+	}
+
+	if scrape.Body != "" {
+		var parts []string
+		s.Find(scrape.Body).Each(func(_ int, body *goquery.Selection) {
+			absolutiseURLs(body, pageURL)
+			if content, err := body.Html(); err == nil && strings.TrimSpace(content) != "" {
+				parts = append(parts, strings.TrimSpace(content))
+			}
+		})
+		item.Content = strings.Join(parts, "\n")
+	}
+
+	return item
+}
+
+// scrapeLink returns the link held by the element matching scrape_link: its
+// href, or the href of the first link inside it.
+func scrapeLink(s *goquery.Selection) (string, bool) {
+	if href, ok := s.Attr("href"); ok && strings.TrimSpace(href) != "" {
+		return strings.TrimSpace(href), true
+	}
+	if href, ok := s.Find("a[href]").First().Attr("href"); ok && strings.TrimSpace(href) != "" {
+		return strings.TrimSpace(href), true
+	}
+	return "", false
+}
+
+func parseScrapedDate(raw, layout string) (time.Time, bool) {
+	if raw == "" {
+		return time.Time{}, false
+	}
+	layouts := scrapeDateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	for _, layout := range layouts {
+		if parsed, err := time.ParseInLocation(layout, raw, time.Local); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// absolutiseURLs rewrites the links and image sources in s to absolute URLs,
+// since the article is no longer read in the context of the scraped page.
+func absolutiseURLs(s *goquery.Selection, base *url.URL) {
+	for _, attr := range []string{"href", "src"} {
+		s.Find("[" + attr + "]").Each(func(_ int, el *goquery.Selection) {
+			if resolved, err := base.Parse(strings.TrimSpace(el.AttrOr(attr, ""))); err == nil {
+				el.SetAttr(attr, resolved.String())
+			}
+		})
+	}
+}
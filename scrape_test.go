@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadScrapeOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		want    *ScrapeOptions
+		wantErr bool
+	}{
+		{name: "regular feed", section: "url = https://example.com/feed"},
+		{name: "explicit feed type", section: "type = feed"},
+		{
+			name:    "defaults",
+			section: "type = scrape\nscrape_item = article",
+			want:    &ScrapeOptions{Item: "article", Title: defaultScrapeTitle, Link: defaultScrapeLink},
+		},
+		{
+			name:    "all selectors",
+			section: "type = scrape\nscrape_item = li.post\nscrape_title = .title\nscrape_link = a.permalink\nscrape_date = time\nscrape_date_format = 02.01.2006\nscrape_body = .summary",
+			want:    &ScrapeOptions{Item: "li.post", Title: ".title", Link: "a.permalink", Date: "time", DateFormat: "02.01.2006", Body: ".summary"},
+		},
+		{
+			name:    "id selectors",
+			section: "type = scrape\nscrape_item = div#posts > article\nscrape_body = #content",
+			want:    &ScrapeOptions{Item: "div#posts > article", Title: defaultScrapeTitle, Link: defaultScrapeLink, Body: "#content"},
+		},
+		{name: "missing item", section: "type = scrape", wantErr: true},
+		{name: "invalid selector", section: "type = scrape\nscrape_item = div[", wantErr: true},
+		{name: "unknown type", section: "type = atom", wantErr: true},
+		{name: "selector without type", section: "scrape_item = article", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadINI([]byte("[feed \"Test\"]\n" + tt.section + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadScrapeOptions(cfg.Section("feed \"Test\""))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadScrapeOptions returned error: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfigScrapeIDSelectors(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	cfgPath, err := configFilePath()
+	if err != nil {
+		t.Fatalf("configFilePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	content := "[feed \"Example News\"]\n" +
+		"url = https://example.com/news/\n" +
+		"type = scrape\n" +
+		"scrape_item = div#posts > article\n" +
+		"scrape_body = #content\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	feed, ok := Config.FeedByName("Example News")
+	if !ok || feed.Scrape == nil {
+		t.Fatalf("expected scrape feed to be loaded, got %+v", Config.Feeds)
+	}
+	if feed.Scrape.Item != "div#posts > article" || feed.Scrape.Body != "#content" {
+		t.Fatalf("expected selectors with IDs to be kept whole, got %+v", feed.Scrape)
+	}
+}
+
+func TestUpdateFeedScrape(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnvVar, "")
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>News</title></head><body>
+<ul class="posts">
+  <li class="post">
+    <h2><a href="/posts/second">Second post</a></h2>
+    <time datetime="2024-03-02T10:00:00Z">March 2</time>
+    <div class="summary"><p>The second <a href="/more">post</a>.</p><img src="img/2.png"></div>
+  </li>
+  <li class="post">
+    <h2><a href="first.html">First   post</a></h2>
+    <time>2024-03-01</time>
+    <div class="summary"><p>The first post.</p></div>
+  </li>
+  <li class="post"><span>Neither title nor link</span></li>
+</ul>
+</body></html>`))
+	}))
+	t.Cleanup(server.Close)
+
+	Config.Feeds = []Feed{{
+		Name:        "news",
+		URL:         server.URL + "/blog/",
+		Scrape:      &ScrapeOptions{Item: "li.post", Title: "h2", Link: "h2 a", Date: "time", Body: ".summary"},
+		FeedOptions: FeedOptions{Format: "json"},
+	}}
+	if err := InitialiseNewArticleDirectory(); err != nil {
+		t.Fatalf("InitialiseNewArticleDirectory returned error: %v", err)
+	}
+	result, err := UpdateFeed("news", false)
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if result.Total != 2 || result.Downloaded != 2 {
+		t.Fatalf("expected 2 scraped items to be stored, got %+v", result)
+	}
+
+	second, err := os.ReadFile(filepath.Join(Config.FeedDirectory, "news", "Second post.json"))
+	if err != nil {
+		t.Fatalf("read article: %v", err)
+	}
+	for _, want := range []string{
+		`"link": "` + server.URL + `/posts/second"`,
+		`href=\"` + server.URL + `/more\"`,
+		`src=\"` + server.URL + `/blog/img/2.png\"`,
+	} {
+		if !strings.Contains(string(second), want) {
+			t.Errorf("expected article to contain %s, got:\n%s", want, second)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(Config.FeedDirectory, "news", "First post.json"))
+	if err != nil {
+		t.Fatalf("expected article with collapsed title: %v", err)
+	}
+	if want := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local); !info.ModTime().Equal(want) {
+		t.Fatalf("expected article mtime %v from scraped date, got %v", want, info.ModTime())
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const feedStateFileName = ".rssnix.json"
+
+// seenItem records a feed item that has already been processed, along with
+// the article file it was stored in.
+type seenItem struct {
+	File       string             `json:"file,omitempty"`
+	Title      string             `json:"title,omitempty"`
+	Link       string             `json:"link,omitempty"`
+	Published  *time.Time         `json:"published,omitempty"`
+	Added      time.Time          `json:"added"`
+	Enclosures []*storedEnclosure `json:"enclosures,omitempty"`
+}
+
+// feedState is the persistent per-feed metadata kept alongside the articles.
+type feedState struct {
+	Title        string               `json:"title,omitempty"`
+	SiteURL      string               `json:"site_url,omitempty"`
+	LastFetch    time.Time            `json:"last_fetch,omitempty"`
+	LastError    string               `json:"last_error,omitempty"`
+	LastErrorAt  time.Time            `json:"last_error_at,omitempty"`
+	ETag         string               `json:"etag,omitempty"`
+	LastModified string               `json:"last_modified,omitempty"`
+	Items        map[string]*seenItem `json:"items"`
+}
+
+// date returns when the item was published, or when it was first seen if
+// the feed gave no publication date.
+func (s *seenItem) date() time.Time {
+	if s.Published != nil {
+		return *s.Published
+	}
+	return s.Added
+}
+
+func feedStatePath(dir string) string {
+	return filepath.Join(dir, feedStateFileName)
+}
+
+func newFeedState() *feedState {
+	return &feedState{Items: map[string]*seenItem{}}
+}
+
+func loadFeedState(dir string) (*feedState, error) {
+	state := newFeedState()
+
+	data, err := os.ReadFile(feedStatePath(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read feed state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parse feed state %q: %w", feedStatePath(dir), err)
+	}
+	if state.Items == nil {
+		state.Items = map[string]*seenItem{}
+	}
+
+	return state, nil
+}
+
+func (s *feedState) save(dir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode feed state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, feedStateFileName+".*")
+	if err != nil {
+		return fmt.Errorf("create feed state: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write feed state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write feed state: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write feed state: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), feedStatePath(dir))
+}
+
+// claimedFiles returns the set of article and enclosure file names
+// referenced by the index.
+func (s *feedState) claimedFiles() map[string]bool {
+	claimed := make(map[string]bool, len(s.Items))
+	for _, seen := range s.Items {
+		if seen.File != "" {
+			claimed[seen.File] = true
+		}
+		for _, enclosure := range seen.Enclosures {
+			if enclosure.File != "" {
+				claimed[enclosure.File] = true
+			}
+		}
+	}
+	return claimed
+}
+
+// itemKey returns a stable identifier for a feed item: its GUID, falling back
+// to its link and finally to a hash of its content.
+func itemKey(item *gofeed.Item) string {
+	if guid := strings.TrimSpace(item.GUID); guid != "" {
+		return "guid:" + guid
+	}
+	if link := strings.TrimSpace(item.Link); link != "" {
+		return "link:" + link
+	}
+
+	return "sha256:" + itemHash(item)
+}
+
+// itemHash returns a hex-encoded SHA-256 hash of the item's title,
+// description and content.
+func itemHash(item *gofeed.Item) string {
+	h := sha256.New()
+	for _, part := range []string{item.Title, item.Description, item.Content} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// uniqueArticleName returns base+ext, or base with a " (N)" suffix followed by
+// ext, such that the result is neither claimed by another item nor present
+// in dir.
+func uniqueArticleName(dir, base, ext string, claimed map[string]bool) string {
+	name := base + ext
+	for n := 2; ; n++ {
+		if !claimed[name] {
+			if _, err := os.Lstat(filepath.Join(dir, name)); errors.Is(err, os.ErrNotExist) {
+				return name
+			}
+		}
+		suffix := " (" + strconv.Itoa(n) + ")"
+		name = truncateString(base, maxFileNameLength-len(suffix)-len(ext)) + suffix + ext
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestItemKeyFallbacks(t *testing.T) {
+	withGUID := &gofeed.Item{GUID: "abc", Link: "https://example.com/a", Title: "A"}
+	if got := itemKey(withGUID); got != "guid:abc" {
+		t.Errorf("expected GUID key, got %q", got)
+	}
+
+	withLink := &gofeed.Item{Link: "https://example.com/a", Title: "A"}
+	if got := itemKey(withLink); got != "link:https://example.com/a" {
+		t.Errorf("expected link key, got %q", got)
+	}
+
+	first := itemKey(&gofeed.Item{Title: "A", Content: "one"})
+	second := itemKey(&gofeed.Item{Title: "A", Content: "two"})
+	if !strings.HasPrefix(first, "sha256:") {
+		t.Errorf("expected content hash key, got %q", first)
+	}
+	if first == second {
+		t.Errorf("expected items with different content to have different keys")
+	}
+}
+
+func TestUniqueArticleName(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Title"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := uniqueArticleName(dir, "Other", "", map[string]bool{}); got != "Other" {
+		t.Errorf("expected free name to be kept, got %q", got)
+	}
+	if got := uniqueArticleName(dir, "Title", "", map[string]bool{}); got != "Title (2)" {
+		t.Errorf("expected existing file to be disambiguated, got %q", got)
+	}
+	if got := uniqueArticleName(dir, "Title", "", map[string]bool{"Title (2)": true}); got != "Title (3)" {
+		t.Errorf("expected claimed name to be skipped, got %q", got)
+	}
+
+	long := strings.Repeat("a", maxFileNameLength)
+	if err := os.WriteFile(filepath.Join(dir, long), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := uniqueArticleName(dir, long, "", map[string]bool{}); len(got) > maxFileNameLength || !strings.HasSuffix(got, " (2)") {
+		t.Errorf("expected suffixed name within %d bytes, got %d bytes", maxFileNameLength, len(got))
+	}
+}
+
+func TestFeedStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	state, err := loadFeedState(dir)
+	if err != nil {
+		t.Fatalf("loadFeedState returned error: %v", err)
+	}
+	if len(state.Items) != 0 {
+		t.Fatalf("expected empty state, got %d items", len(state.Items))
+	}
+
+	state.Items["guid:1"] = &seenItem{File: "One", Title: "One"}
+	if err := state.save(dir); err != nil {
+		t.Fatalf("save returned error: %v", err)
+	}
+
+	reloaded, err := loadFeedState(dir)
+	if err != nil {
+		t.Fatalf("loadFeedState returned error: %v", err)
+	}
+	if seen, ok := reloaded.Items["guid:1"]; !ok || seen.File != "One" {
+		t.Fatalf("expected item to survive round trip, got %+v", reloaded.Items)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes reported by the update, refetch and check commands.
+const (
+	exitError          = 1
+	exitPartialFailure = 2
+	exitTotalFailure   = 3
+)
+
+type updateSummary struct {
+	Feeds      []FeedUpdateResult `json:"feeds"`
+	Downloaded int                `json:"downloaded"`
+	Skipped    int                `json:"skipped"`
+	Total      int                `json:"total"`
+	Failed     int                `json:"failed"`
+}
+
+func summariseUpdate(results []FeedUpdateResult) updateSummary {
+	summary := updateSummary{Feeds: results}
+	for _, result := range results {
+		summary.Downloaded += result.Downloaded
+		summary.Skipped += result.Skipped
+		summary.Total += result.Total
+		if result.Error != "" {
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+// writeUpdateSummary prints the outcome of an update as either a table or a
+// JSON document.
+func writeUpdateSummary(w io.Writer, summary updateSummary, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summary)
+	case "text", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FEED\tDOWNLOADED\tSKIPPED\tTOTAL\tSTATUS")
+		for _, result := range summary.Feeds {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", result.Name, result.Downloaded, result.Skipped, result.Total, result.status())
+		}
+		fmt.Fprintf(tw, "%d feeds\t%d\t%d\t%d\t%d failed\n", len(summary.Feeds), summary.Downloaded, summary.Skipped, summary.Total, summary.Failed)
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown summary format %q: expected text or json", format)
+	}
+}
+
+// updateExitError returns an error carrying a non-zero exit code when some
+// or all of the feeds failed to update.
+func updateExitError(summary updateSummary) error {
+	switch {
+	case summary.Failed == 0:
+		return nil
+	case summary.Failed == len(summary.Feeds):
+		return cli.Exit(fmt.Sprintf("all %d feeds failed to update", summary.Failed), exitTotalFailure)
+	default:
+		return cli.Exit(fmt.Sprintf("%d of %d feeds failed to update", summary.Failed, len(summary.Feeds)), exitPartialFailure)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestUpdateExitError(t *testing.T) {
+	ok := FeedUpdateResult{Name: "ok", Downloaded: 1, Total: 3}
+	failed := FeedUpdateResult{Name: "failed", Error: "boom"}
+
+	if err := updateExitError(summariseUpdate([]FeedUpdateResult{ok, ok})); err != nil {
+		t.Fatalf("expected no error when all feeds succeed, got %v", err)
+	}
+
+	tests := []struct {
+		results []FeedUpdateResult
+		code    int
+	}{
+		{[]FeedUpdateResult{ok, failed}, exitPartialFailure},
+		{[]FeedUpdateResult{failed, failed}, exitTotalFailure},
+	}
+	for _, tc := range tests {
+		err := updateExitError(summariseUpdate(tc.results))
+		exitErr, isExit := err.(cli.ExitCoder)
+		if !isExit || exitErr.ExitCode() != tc.code {
+			t.Errorf("expected exit code %d, got %v", tc.code, err)
+		}
+	}
+}
+
+func TestWriteUpdateSummary(t *testing.T) {
+	summary := summariseUpdate([]FeedUpdateResult{
+		{Name: "first", Downloaded: 2, Skipped: 1, Total: 3},
+		{Name: "second", NotModified: true},
+		{Name: "third", Error: "fetch failed"},
+	})
+	if summary.Downloaded != 2 || summary.Skipped != 1 || summary.Total != 3 || summary.Failed != 1 {
+		t.Fatalf("unexpected totals: %+v", summary)
+	}
+
+	var text bytes.Buffer
+	if err := writeUpdateSummary(&text, summary, "text"); err != nil {
+		t.Fatalf("writeUpdateSummary returned error: %v", err)
+	}
+	for _, want := range []string{"first", "not modified", "error: fetch failed", "1 failed"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("expected text summary to contain %q, got:\n%s", want, text.String())
+		}
+	}
+
+	var encoded bytes.Buffer
+	if err := writeUpdateSummary(&encoded, summary, "json"); err != nil {
+		t.Fatalf("writeUpdateSummary returned error: %v", err)
+	}
+	var decoded updateSummary
+	if err := json.Unmarshal(encoded.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if len(decoded.Feeds) != 3 || decoded.Feeds[2].Error != "fetch failed" || decoded.Failed != 1 {
+		t.Fatalf("unexpected decoded summary: %+v", decoded)
+	}
+
+	if err := writeUpdateSummary(&encoded, summary, "xml"); err == nil {
+		t.Fatalf("expected unknown format to be rejected")
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// textWidth is the column at which plain-text articles are wrapped.
+const textWidth = 72
+
+// renderText writes the item as wrapped plain text converted from its HTML,
+// preceded by a short header and followed by a numbered list of the links
+// referenced in the body.
+func renderText(a *article) ([]byte, error) {
+	item := a.Item
+
+	var b strings.Builder
+	if title := strings.TrimSpace(item.Title); title != "" {
+		b.WriteString(title + "\n")
+		b.WriteString(strings.Repeat("=", utf8.RuneCountInString(title)) + "\n\n")
+	}
+	writeTextField(&b, "Feed", a.Feed.Name)
+	writeTextField(&b, "Link", item.Link)
+	writeTextField(&b, "Author", itemAuthor(item))
+	if item.PublishedParsed != nil {
+		writeTextField(&b, "Published", item.PublishedParsed.Format(time.RFC1123Z))
+	} else {
+		writeTextField(&b, "Published", item.Published)
+	}
+
+	body := item.Content
+	if strings.TrimSpace(body) == "" {
+		body = item.Description
+	}
+	text, err := htmlToText(body, item.Link, textWidth)
+	if err != nil {
+		return nil, err
+	}
+	if text != "" {
+		b.WriteString("\n" + text + "\n")
+	}
+
+	return []byte(b.String()), nil
+}
+
+func writeTextField(b *strings.Builder, key, value string) {
+	if value == "" {
+		return
+	}
+	b.WriteString(key + ": " + value + "\n")
+}
+
+// htmlToText converts an HTML fragment to plain text wrapped at width
+// columns. Links and images are replaced by numbered references, resolved
+// against base and listed at the end. Input without any markup is wrapped
+// paragraph by paragraph.
+func htmlToText(s, base string, width int) (string, error) {
+	if !strings.Contains(s, "<") {
+		var paragraphs []string
+		for _, paragraph := range strings.Split(html.UnescapeString(s), "\n\n") {
+			if wrapped := wrapText(collapseWhitespace(paragraph), width, "", ""); wrapped != "" {
+				paragraphs = append(paragraphs, wrapped)
+			}
+		}
+		return strings.Join(paragraphs, "\n\n"), nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+
+	r := &textRenderer{width: width, refs: map[string]int{}}
+	if parsed, err := url.Parse(base); err == nil {
+		r.base = parsed
+	}
+	r.walk(doc.Find("body"))
+	r.flush()
+
+	out := strings.Join(r.blocks, "\n\n")
+	if len(r.links) > 0 {
+		var refs strings.Builder
+		refs.WriteString("Links:\n")
+		for i, link := range r.links {
+			refs.WriteString("[" + strconv.Itoa(i+1) + "] " + link + "\n")
+		}
+		out += "\n\n" + strings.TrimSuffix(refs.String(), "\n")
+	}
+	return out, nil
+}
+
+type textRenderer struct {
+	width int
+	base  *url.URL
+
+	// inline collects the text of the current paragraph, with '\n' marking
+	// explicit line breaks.
+	inline strings.Builder
+	blocks []string
+
+	// indent prefixes every line of the current block; marker, if set,
+	// replaces it on the first line, e.g. for list bullets.
+	indent string
+	marker string
+	start  int
+
+	links []string
+	refs  map[string]int
+}
+
+func (r *textRenderer) walk(s *goquery.Selection) {
+	s.Contents().Each(func(_ int, child *goquery.Selection) {
+		node := child.Get(0)
+		switch node.Type {
+		case html.TextNode:
+			r.inline.WriteString(node.Data)
+		case html.ElementNode:
+			r.element(child)
+		}
+	})
+}
+
+func (r *textRenderer) element(s *goquery.Selection) {
+	switch name := goquery.NodeName(s); name {
+	case "script", "style", "noscript", "iframe", "head", "template":
+	case "br":
+		r.inline.WriteByte('\n')
+	case "hr":
+		r.flush()
+		r.addBlock(strings.Repeat("-", 10))
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		r.flush()
+		r.walk(s)
+		heading := strings.TrimSpace(collapseWhitespace(r.inline.String()))
+		r.inline.Reset()
+		if heading == "" {
+			break
+		}
+		underline := "-"
+		if name == "h1" {
+			underline = "="
+		}
+		r.addBlock(r.wrap(heading) + "\n" + r.indent + strings.Repeat(underline, utf8.RuneCountInString(heading)))
+	case "pre":
+		r.flush()
+		code := strings.Trim(s.Text(), "\n")
+		if strings.TrimSpace(code) == "" {
+			break
+		}
+		var lines []string
+		for _, line := range strings.Split(code, "\n") {
+			lines = append(lines, strings.TrimRight(r.indent+"    "+line, " \t"))
+		}
+		r.addBlock(strings.Join(lines, "\n"))
+	case "blockquote":
+		r.flush()
+		r.enter()
+		indent, marker := r.indent, r.marker
+		r.indent = indent + "> "
+		if marker != "" {
+			r.marker = marker + "> "
+		}
+		r.walk(s)
+		r.flush()
+		r.indent, r.marker = indent, ""
+	case "ul", "ol":
+		r.flush()
+		r.enter()
+		number := 1
+		if start, err := strconv.Atoi(s.AttrOr("start", "")); err == nil {
+			number = start
+		}
+		indent := r.indent
+		s.ChildrenFiltered("li").Each(func(_ int, li *goquery.Selection) {
+			bullet := "* "
+			if name == "ol" {
+				bullet = strconv.Itoa(number) + ". "
+				number++
+			}
+			r.indent, r.marker = indent+strings.Repeat(" ", len(bullet)), indent+bullet
+			r.walk(li)
+			r.flush()
+		})
+		r.indent, r.marker = indent, ""
+	case "table":
+		r.flush()
+		var rows []string
+		s.Find("tr").Each(func(_ int, tr *goquery.Selection) {
+			var cells []string
+			tr.ChildrenFiltered("td, th").Each(func(_ int, cell *goquery.Selection) {
+				r.walk(cell)
+				cells = append(cells, strings.TrimSpace(collapseWhitespace(r.inline.String())))
+				r.inline.Reset()
+			})
+			if row := strings.Join(cells, " | "); strings.Trim(row, " |") != "" {
+				rows = append(rows, r.wrap(row))
+			}
+		})
+		if len(rows) > 0 {
+			r.addBlock(strings.Join(rows, "\n"))
+		}
+	case "a":
+		r.walk(s)
+		if href := r.resolve(s.AttrOr("href", "")); href != "" {
+			r.inline.WriteString(" [" + strconv.Itoa(r.ref(href)) + "]")
+		}
+	case "img":
+		src := r.resolve(s.AttrOr("src", ""))
+		if src == "" {
+			break
+		}
+		alt := strings.TrimSpace(s.AttrOr("alt", ""))
+		if alt == "" {
+			alt = "image"
+		}
+		r.inline.WriteString("[" + alt + "][" + strconv.Itoa(r.ref(src)) + "]")
+	case "p", "div", "section", "article", "header", "footer", "main", "aside", "nav",
+		"figure", "figcaption", "dl", "dt", "dd", "details", "summary", "li":
+		r.flush()
+		r.walk(s)
+		r.flush()
+	default:
+		r.walk(s)
+	}
+}
+
+// flush wraps the pending inline text into a block.
+func (r *textRenderer) flush() {
+	text := r.inline.String()
+	r.inline.Reset()
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(collapseWhitespace(line)); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	var wrapped []string
+	for _, line := range lines {
+		wrapped = append(wrapped, r.wrap(line))
+	}
+	r.addBlock(strings.Join(wrapped, "\n"))
+}
+
+// wrap wraps line using the current indent, consuming the marker if one is
+// pending.
+func (r *textRenderer) wrap(line string) string {
+	first := r.indent
+	if r.marker != "" {
+		first, r.marker = r.marker, ""
+	}
+	return wrapText(line, r.width, first, r.indent)
+}
+
+// enter marks the start of a list or quotation. Blocks inside it are kept
+// on consecutive lines rather than separated by blank lines.
+func (r *textRenderer) enter() {
+	if r.indent == "" {
+		r.start = len(r.blocks)
+	}
+}
+
+// addBlock appends a block, prefixing it with the pending marker.
+func (r *textRenderer) addBlock(block string) {
+	if r.marker != "" {
+		block = r.marker + strings.TrimPrefix(block, r.indent)
+		r.marker = ""
+	}
+	if n := len(r.blocks); r.indent != "" && n > r.start {
+		separator := "\n"
+		if quote := strings.TrimRight(r.indent, " "); quote != "" {
+			separator += quote + "\n"
+		}
+		r.blocks[n-1] += separator + block
+		return
+	}
+	r.blocks = append(r.blocks, block)
+}
+
+// ref returns the reference number of link, adding it to the list of links
+// if it is not there yet.
+func (r *textRenderer) ref(link string) int {
+	if n, ok := r.refs[link]; ok {
+		return n
+	}
+	r.links = append(r.links, link)
+	r.refs[link] = len(r.links)
+	return len(r.links)
+}
+
+// resolve returns ref resolved against the article link, dropping links to
+// fragments of the same page and javascript: URLs.
+func (r *textRenderer) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(strings.ToLower(ref), "javascript:") {
+		return ""
+	}
+	if r.base == nil {
+		return ref
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return r.base.ResolveReference(parsed).String()
+}
+
+// wrapText breaks s into lines of at most width columns, prefixing the first
+// line with first and the rest with rest. Words longer than a line are kept
+// whole.
+func wrapText(s string, width int, first, rest string) string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	line := first + words[0]
+	for _, word := range words[1:] {
+		if utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width {
+			b.WriteString(line + "\n")
+			line = rest + word
+			continue
+		}
+		line += " " + word
+	}
+	b.WriteString(line)
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		input string
+		first string
+		rest  string
+		want  string
+	}{
+		{"one two three four", "", "", "one two\nthree four"},
+		{"one two three", "* ", "  ", "* one two\n  three"},
+		{"averyverylongword x", "", "", "averyverylongword\nx"},
+		{"   ", "", "", ""},
+	}
+
+	for _, tc := range tests {
+		if got := wrapText(tc.input, 10, tc.first, tc.rest); got != tc.want {
+			t.Errorf("wrapText(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Plain &amp; simple\n\nSecond paragraph", "Plain & simple\n\nSecond paragraph"},
+		{"<h2>Heading</h2><p>Some <b>bold</b> text.</p>", "Heading\n-------\n\nSome bold text."},
+		{
+			`<p>See <a href="/post">this</a>, <a href="https://other.example/">that</a> and <a href="/post">this again</a>.</p><p><a href="#top">Top</a></p>`,
+			"See this [1], that [2] and this again [1].\n\nTop\n\nLinks:\n[1] https://example.com/post\n[2] https://other.example/",
+		},
+		{"<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul><p>after</p>", "* one\n* two\n  1. nested\n\nafter"},
+		{"<blockquote><p>first</p><p>second</p></blockquote>", "> first\n>\n> second"},
+		{"<pre>x := 1\n  y</pre>", "    x := 1\n      y"},
+		{"<p>line<br>break</p><script>alert(1)</script>", "line\nbreak"},
+		{`<img src="img.png" alt="Picture">`, "[Picture][1]\n\nLinks:\n[1] https://example.com/img.png"},
+		{"<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>", "a | b\n1 | 2"},
+		{"<p>" + strings.Repeat("word ", 20) + "</p>", strings.TrimSpace(strings.Repeat("word ", 14)) + "\n" + strings.TrimSpace(strings.Repeat("word ", 6))},
+	}
+
+	for _, tc := range tests {
+		got, err := htmlToText(tc.input, "https://example.com/article", textWidth)
+		if err != nil {
+			t.Fatalf("htmlToText(%q) returned error: %v", tc.input, err)
+		}
+		if got != tc.want {
+			t.Errorf("htmlToText(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	item := &gofeed.Item{
+		Title:       "Title",
+		Link:        "https://example.com/article",
+		Published:   "Mon, 02 Jan 2006 15:04:05 MST",
+		Description: "Summary",
+		Content:     `<p>Body with <a href="/more">a link</a></p>`,
+	}
+
+	content, err := renderText(&article{Feed: Feed{Name: "test-feed"}, Item: item})
+	if err != nil {
+		t.Fatalf("renderText returned error: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"Title",
+		"=====",
+		"",
+		"Feed: test-feed",
+		"Link: https://example.com/article",
+		"Published: Mon, 02 Jan 2006 15:04:05 MST",
+		"",
+		"Body with a link [1]",
+		"",
+		"Links:",
+		"[1] https://example.com/more",
+		"",
+	}, "\n")
+	if string(content) != want {
+		t.Fatalf("unexpected text:\n%s\nwant:\n%s", content, want)
+	}
+}